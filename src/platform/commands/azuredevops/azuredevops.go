@@ -3,7 +3,7 @@ package azuredevops_command
 import (
 	"embed"
 	"fmt"
-	"log"
+	ci "main/interfaces/ci"
 	config "main/interfaces/configuration"
 	"os"
 	"os/exec"
@@ -83,7 +83,7 @@ func GetCommand() *cli.Command {
 				},
 				Action: func(ctx *cli.Context) error {
 
-					fmt.Println("##[group] Azure DevOps")
+					ci.Group("Azure DevOps")
 					// App Config Store
 					endpoint := "https://my-app.azconfig.io"
 
@@ -98,19 +98,25 @@ func GetCommand() *cli.Command {
 
 					configBuilder := config.GetBuilder("azconfig.io")
 					configDirector := config.NewDirector(configBuilder)
-					configmap := configDirector.Build(endpoint, labels)
+					configmap, err := configDirector.Build(endpoint, labels)
+					if err != nil {
+						ci.EndGroup()
+						return err
+					}
 
 					organization = configmap.List["ADO_ORGANIZATION"].Value
 					pat_token = configmap.List["ADO_PAT_TOKEN"].Value
 
 					connect, err := scripts.ReadFile("bash/scale.sh")
 					if err != nil {
-						log.Fatal(err)
+						ci.EndGroup()
+						return err
 					}
 
 					file, err := os.CreateTemp("/tmp", "platform.*.sh")
 					if err != nil {
-						log.Fatal(err)
+						ci.EndGroup()
+						return err
 					}
 					file.Write(connect)
 
@@ -124,14 +130,14 @@ func GetCommand() *cli.Command {
 					).Output()
 
 					if err != nil {
-						fmt.Printf("error %s\n", err)
+						ci.Error("%v", err)
 					}
 
 					output := string(cmd)
 					fmt.Println(output)
 					defer os.Remove(file.Name())
 
-					fmt.Println("##[endgroup]")
+					ci.EndGroup()
 					return nil
 				},
 				CustomHelpTemplate: get_help_text("scale"),
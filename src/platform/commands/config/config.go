@@ -3,7 +3,6 @@ package config_command
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	config "main/interfaces/configuration"
 	"slices"
 	"sort"
@@ -160,7 +159,10 @@ func GetCommand() *cli.Command {
 
 					configBuilder := config.GetBuilder("azconfig.io")
 					configDirector := config.NewDirector(configBuilder)
-					configmap := configDirector.Build(endpoint, labels)
+					configmap, err := configDirector.Build(endpoint, labels)
+					if err != nil {
+						return err
+					}
 
 					var keyValueSlice KeyValueSlice
 					for _, value := range configmap.List {
@@ -180,7 +182,7 @@ func GetCommand() *cli.Command {
 						}
 						val, err := json.MarshalIndent(json_output, "", "    ")
 						if err != nil {
-							log.Fatal("Failed to marshal JSON Output: ", err)
+							return fmt.Errorf("failed to marshal JSON output: %w", err)
 						}
 						fmt.Println(string(val))
 					case "env":
@@ -198,7 +200,7 @@ func GetCommand() *cli.Command {
 						}
 						val, err := yaml.Marshal(yaml_output)
 						if err != nil {
-							log.Fatal("Failed to marshal JSON Output: ", err)
+							return fmt.Errorf("failed to marshal YAML output: %w", err)
 						}
 						fmt.Println(string(val))
 					}
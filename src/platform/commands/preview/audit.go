@@ -0,0 +1,426 @@
+package preview_command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ci "main/interfaces/ci"
+	iac "main/interfaces/iac"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	managementEndpoint = "https://management.azure.com"
+
+	previewResourcesQuery     = "Resources | where tags['ExpirationDate']!='' and tags['TerraformCloud']!='' | summarize resources = count() by workspace = tostring(tags.TerraformCloud)"
+	previewResourceGroupQuery = "ResourceContainers | where type == 'microsoft.resources/subscriptions/resourcegroups' and tags['ExpirationDate']!='' and tags['TerraformCloud']!='' | project id = tolower(id), workspace = tostring(tags.TerraformCloud)"
+)
+
+const (
+	auditOrphanedResources     = "orphaned-resources"
+	auditOrphanedResourceGroup = "orphaned-resource-group"
+	auditEmptyWorkspace        = "empty-workspace"
+	auditErroredRun            = "errored-run"
+)
+
+// Something audit found out of sync between Azure and Terraform Cloud. Only
+// findings with an action can be fixed; the rest need a closer look.
+type auditFinding struct {
+	kind           string
+	workspace      string
+	resource_group string
+	detail         string
+	action         string
+	result         string
+}
+
+// Summarizes the resources of the given resource groups, so a group is only
+// deleted when everything in it belongs to the same workspace.
+func getResourceGroupContentsQuery(ids []string) string {
+	return "Resources | extend rg = tolower(strcat('/subscriptions/', subscriptionId, '/resourceGroups/', resourceGroup)) | where rg in ('" + strings.Join(ids, "', '") + "') | summarize resources = count(), workspaces = make_set(tostring(tags.TerraformCloud)) by rg"
+}
+
+// Reports whether a run is still queued or in progress.
+func isRunActive(status string) bool {
+	final := []string{
+		"",
+		"applied",
+		"errored",
+		"canceled",
+		"discarded",
+		"planned_and_finished",
+		"force_canceled",
+	}
+	return !slices.Contains(final, status)
+}
+
+// Returns the workspaces tagged on Azure resources or resource groups that
+// are not previews, so they can be looked up across the organization.
+func getUnlistedWorkspaces(previews []iac.Preview, resources []map[string]interface{}, groups []map[string]interface{}) []string {
+
+	var names []string
+	for _, rows := range [][]map[string]interface{}{resources, groups} {
+		for _, row := range rows {
+			name, _ := row["workspace"].(string)
+			if len(name) == 0 || slices.Contains(names, name) || slices.ContainsFunc(previews, func(p iac.Preview) bool { return p.Name == name }) {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cross-references preview resources in Azure with the preview workspaces.
+// Resources of workspaces that exist outside the preview project are left
+// alone. Workspaces younger than min_age are skipped, as their first run may
+// not have created any resources yet.
+func getAuditFindings(previews []iac.Preview, elsewhere []string, resources []map[string]interface{}, groups []map[string]interface{}, contents []map[string]interface{}, min_age time.Duration, now time.Time) []auditFinding {
+
+	var (
+		findings  []auditFinding
+		workspace = make(map[string]bool)
+		in_azure  = make(map[string]bool)
+	)
+
+	for _, p := range previews {
+		workspace[p.Name] = true
+	}
+	for _, name := range elsewhere {
+		workspace[name] = true
+	}
+
+	// Azure resources whose workspace no longer exists
+	for _, row := range resources {
+		name, _ := row["workspace"].(string)
+		count, _ := row["resources"].(float64)
+		if len(name) == 0 {
+			continue
+		}
+		in_azure[name] = true
+		if !workspace[name] {
+			findings = append(findings, auditFinding{
+				kind:      auditOrphanedResources,
+				workspace: name,
+				detail:    fmt.Sprintf("%d resource(s) tagged with a workspace that does not exist", int(count)),
+			})
+		}
+	}
+
+	owners := make(map[string][]string)
+	for _, row := range contents {
+		id, _ := row["rg"].(string)
+		if list, ok := row["workspaces"].([]interface{}); ok {
+			for _, w := range list {
+				name, _ := w.(string)
+				owners[id] = append(owners[id], name)
+			}
+		}
+	}
+	for _, row := range groups {
+		id, _ := row["id"].(string)
+		name, _ := row["workspace"].(string)
+		if len(id) == 0 || workspace[name] {
+			continue
+		}
+		in_azure[name] = true
+
+		finding := auditFinding{
+			kind:           auditOrphanedResourceGroup,
+			workspace:      name,
+			resource_group: id,
+		}
+		if others := slices.DeleteFunc(slices.Clone(owners[id]), func(o string) bool { return o == name }); len(others) == 0 {
+			finding.detail = id
+			finding.action = "delete resource group"
+		} else {
+			finding.detail = id + " also holds resources of other workspaces or untagged resources"
+		}
+		findings = append(findings, finding)
+	}
+
+	// Workspaces without resources, or whose latest run errored
+	for _, p := range previews {
+		if in_azure[p.Name] || isRunActive(p.RunStatus) || now.Sub(p.CreatedAt) < min_age {
+			if p.RunStatus == "errored" {
+				findings = append(findings, auditFinding{
+					kind:      auditErroredRun,
+					workspace: p.Name,
+					detail:    "latest run errored",
+				})
+			}
+			continue
+		}
+
+		finding := auditFinding{
+			kind:      auditEmptyWorkspace,
+			workspace: p.Name,
+			detail:    "no resources in Azure",
+		}
+		if p.RunStatus == "errored" {
+			finding.detail += " and latest run errored"
+		}
+		if p.ResourceCount == 0 {
+			finding.action = "delete workspace"
+		} else {
+			finding.detail += fmt.Sprintf(", but %d resource(s) in state", p.ResourceCount)
+		}
+		findings = append(findings, finding)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].kind != findings[j].kind {
+			return findings[i].kind < findings[j].kind
+		}
+		return findings[i].workspace < findings[j].workspace
+	})
+	return findings
+}
+
+// Starts the deletion of a resource group. Deletion continues in Azure after
+// the request is accepted.
+func deleteResourceGroup(ctx context.Context, id string) error {
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return err
+	}
+
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{
+		Scopes: []string{managementEndpoint + "/.default"},
+	})
+	if err != nil {
+		return err
+	}
+
+	uri := managementEndpoint + id + "?api-version=2021-04-01"
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected response from Azure Resource Manager: %s", res.Status)
+	}
+	return nil
+}
+
+func printAuditFindings(findings []auditFinding, results bool) error {
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if results {
+		fmt.Fprintln(w, "KIND\tWORKSPACE\tDETAIL\tACTION\tRESULT")
+	} else {
+		fmt.Fprintln(w, "KIND\tWORKSPACE\tDETAIL\tACTION")
+	}
+	for _, f := range findings {
+		action := f.action
+		if len(action) == 0 {
+			action = "-"
+		}
+		if results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.kind, f.workspace, f.detail, action, f.result)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.kind, f.workspace, f.detail, action)
+		}
+	}
+	return w.Flush()
+}
+
+func getAuditCommand() *cli.Command {
+
+	var (
+		fix         bool
+		yes         bool
+		min_age     time.Duration
+		parallelism int
+	)
+
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "Finds Azure resources and workspaces of previews that are out of sync",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "fix",
+				Usage:       "Clean up what is safe: orphaned resource groups and empty workspaces.",
+				Destination: &fix,
+				Required:    false,
+			},
+			&cli.BoolFlag{
+				Name:        "yes",
+				Usage:       "Fix without asking for confirmation.",
+				Destination: &yes,
+				Required:    false,
+			},
+			&cli.DurationFlag{
+				Name:        "min-age",
+				Usage:       "How old a workspace must be before it is reported as having no resources.",
+				Destination: &min_age,
+				Value:       time.Hour,
+				Required:    false,
+			},
+			&cli.IntFlag{
+				Name:        "parallelism",
+				Usage:       "Maximum number of workspaces deleted at once.",
+				Destination: &parallelism,
+				Value:       4,
+				Required:    false,
+				Action: func(ctx *cli.Context, parallelism int) error {
+					if parallelism < 1 {
+						return fmt.Errorf("value '%d' not supported. Must be greater than 0", parallelism)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+
+			configmap, err := getConfiguration("audit", "")
+			if err != nil {
+				return err
+			}
+
+			// Local state is per machine, so a missing workspace proves nothing
+			if fix && getBackend(configmap) == "local" {
+				return errors.New("--fix is not supported with the local backend, as other machines may still hold the workspaces")
+			}
+
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			previews, err := wsDirector.List(ctx.Context, configmap)
+			if err != nil {
+				return err
+			}
+
+			resources, err := queryResourceGraph(ctx.Context, configmap, previewResourcesQuery)
+			if err != nil {
+				return err
+			}
+			groups, err := queryResourceGraph(ctx.Context, configmap, previewResourceGroupQuery)
+			if err != nil {
+				return err
+			}
+			var contents []map[string]interface{}
+			if len(groups) != 0 {
+				var ids []string
+				for _, row := range groups {
+					if id, ok := row["id"].(string); ok {
+						ids = append(ids, id)
+					}
+				}
+				contents, err = queryResourceGraph(ctx.Context, configmap, getResourceGroupContentsQuery(ids))
+				if err != nil {
+					return err
+				}
+			}
+
+			var elsewhere []string
+			for _, name := range getUnlistedWorkspaces(previews, resources, groups) {
+				exists, err := wsDirector.Exists(ctx.Context, name)
+				if err != nil {
+					return err
+				}
+				if exists {
+					elsewhere = append(elsewhere, name)
+				}
+			}
+
+			findings := getAuditFindings(previews, elsewhere, resources, groups, contents, min_age, time.Now())
+			ci.Info("Found '%d' issue(s)", len(findings))
+			if len(findings) == 0 {
+				return nil
+			}
+
+			var fixable []*auditFinding
+			for i := range findings {
+				if len(findings[i].action) != 0 {
+					fixable = append(fixable, &findings[i])
+				}
+			}
+
+			if !fix || len(fixable) == 0 {
+				return printAuditFindings(findings, false)
+			}
+
+			if !yes {
+				if err := printAuditFindings(findings, false); err != nil {
+					return err
+				}
+				confirmed, err := iac.Confirm(fmt.Sprintf("Fix '%d' issue(s)?", len(fixable)))
+				if err != nil {
+					return fmt.Errorf("%w. Use --yes to fix without confirming", err)
+				}
+				if !confirmed {
+					ci.Info("Nothing was fixed")
+					return nil
+				}
+			}
+
+			// Fix
+			var workspaces []*auditFinding
+			for _, f := range fixable {
+				switch f.kind {
+				case auditOrphanedResourceGroup:
+					ci.Info("Deleting resource group '%s'", f.resource_group)
+					if err := deleteResourceGroup(ctx.Context, f.resource_group); err != nil {
+						f.result = "failed: " + err.Error()
+					} else {
+						f.result = "deletion started"
+					}
+				case auditEmptyWorkspace:
+					workspaces = append(workspaces, f)
+				}
+			}
+
+			names := make([]string, len(workspaces))
+			for i, f := range workspaces {
+				names[i] = f.workspace
+			}
+			results, err := stopPreviews(names, parallelism)
+			if err != nil {
+				return err
+			}
+			for i, r := range results {
+				workspaces[i].result = "deleted"
+				if r.err != nil {
+					workspaces[i].result = "failed: " + r.err.Error()
+				}
+			}
+
+			// Report
+			failed := 0
+			for _, f := range fixable {
+				if strings.HasPrefix(f.result, "failed") {
+					failed++
+				}
+			}
+			if err := printAuditFindings(findings, true); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d issue(s) failed to be fixed", failed, len(fixable))
+			}
+			return nil
+		},
+		CustomHelpTemplate: get_help_text("audit"),
+		HideHelpCommand:    true,
+	}
+}
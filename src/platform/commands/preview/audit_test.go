@@ -0,0 +1,114 @@
+package preview_command
+
+import (
+	iac "main/interfaces/iac"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetUnlistedWorkspaces(t *testing.T) {
+
+	previews := []iac.Preview{{Name: "api-dev"}}
+	resources := []map[string]interface{}{
+		{"workspace": "api-dev", "resources": float64(2)},
+		{"workspace": "web-old", "resources": float64(1)},
+		{"workspace": ""},
+	}
+	groups := []map[string]interface{}{
+		{"id": "/subscriptions/s/resourcegroups/web-old", "workspace": "web-old"},
+		{"id": "/subscriptions/s/resourcegroups/db-moved", "workspace": "db-moved"},
+	}
+
+	got := getUnlistedWorkspaces(previews, resources, groups)
+	if strings.Join(got, " ") != "db-moved web-old" {
+		t.Errorf("got %v, want db-moved web-old", got)
+	}
+}
+
+func TestGetAuditFindings(t *testing.T) {
+
+	now := time.Unix(1700000000, 0).UTC()
+	old := now.Add(-2 * time.Hour)
+	group := func(name string) map[string]interface{} {
+		return map[string]interface{}{"id": "/subscriptions/s/resourcegroups/" + name, "workspace": name}
+	}
+	contents := func(name string, workspaces ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"rg": "/subscriptions/s/resourcegroups/" + name, "workspaces": workspaces}
+	}
+
+	cases := []struct {
+		name      string
+		previews  []iac.Preview
+		elsewhere []string
+		resources []map[string]interface{}
+		groups    []map[string]interface{}
+		contents  []map[string]interface{}
+		want      []string
+	}{
+		{
+			name:      "in sync",
+			previews:  []iac.Preview{{Name: "api", CreatedAt: old, RunStatus: "applied", ResourceCount: 2}},
+			resources: []map[string]interface{}{{"workspace": "api", "resources": float64(2)}},
+			groups:    []map[string]interface{}{group("api")},
+			contents:  []map[string]interface{}{contents("api", "api")},
+		},
+		{
+			name:      "orphaned group is deleted",
+			resources: []map[string]interface{}{{"workspace": "gone", "resources": float64(2)}},
+			groups:    []map[string]interface{}{group("gone")},
+			contents:  []map[string]interface{}{contents("gone", "gone")},
+			want: []string{
+				"orphaned-resource-group gone delete resource group",
+				"orphaned-resources gone -",
+			},
+		},
+		{
+			name:     "shared group is only reported",
+			groups:   []map[string]interface{}{group("gone")},
+			contents: []map[string]interface{}{contents("gone", "gone", "")},
+			want:     []string{"orphaned-resource-group gone -"},
+		},
+		{
+			name:      "workspace in another project is left alone",
+			elsewhere: []string{"moved"},
+			resources: []map[string]interface{}{{"workspace": "moved", "resources": float64(2)}},
+			groups:    []map[string]interface{}{group("moved")},
+			contents:  []map[string]interface{}{contents("moved", "moved")},
+		},
+		{
+			name:     "empty workspace is deleted",
+			previews: []iac.Preview{{Name: "api", CreatedAt: old, RunStatus: "applied"}},
+			want:     []string{"empty-workspace api delete workspace"},
+		},
+		{
+			name:     "empty workspace with state is only reported",
+			previews: []iac.Preview{{Name: "api", CreatedAt: old, RunStatus: "errored", ResourceCount: 1}},
+			want:     []string{"empty-workspace api -"},
+		},
+		{
+			name:     "young or running workspaces are skipped",
+			previews: []iac.Preview{{Name: "new", CreatedAt: now.Add(-time.Minute), RunStatus: "applied"}, {Name: "busy", CreatedAt: old, RunStatus: "applying"}},
+		},
+		{
+			name:      "errored run with resources",
+			previews:  []iac.Preview{{Name: "api", CreatedAt: old, RunStatus: "errored", ResourceCount: 2}},
+			resources: []map[string]interface{}{{"workspace": "api", "resources": float64(2)}},
+			want:      []string{"errored-run api -"},
+		},
+	}
+
+	for _, c := range cases {
+		var got []string
+		for _, f := range getAuditFindings(c.previews, c.elsewhere, c.resources, c.groups, c.contents, time.Hour, now) {
+			action := f.action
+			if len(action) == 0 {
+				action = "-"
+			}
+			got = append(got, f.kind+" "+f.workspace+" "+action)
+		}
+		if strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package preview_command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/urfave/cli/v2"
+)
+
+const graphEndpoint = "https://graph.microsoft.com/v1.0"
+
+type FederatedIdentityCredential struct {
+	Name      string   `json:"name"`
+	Issuer    string   `json:"issuer"`
+	Subject   string   `json:"subject"`
+	Audiences []string `json:"audiences"`
+}
+
+type doctorCheck struct {
+	name   string
+	passed bool
+	detail string
+}
+
+// Returns the federated identity credentials of an app registration from
+// Microsoft Graph.
+func getFederatedIdentityCredentials(ctx context.Context, client_id string) ([]FederatedIdentityCredential, error) {
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{
+		Scopes: []string{"https://graph.microsoft.com/.default"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("%s/applications(appId='%s')/federatedIdentityCredentials", graphEndpoint, url.PathEscape(client_id))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from Microsoft Graph: %s", res.Status)
+	}
+
+	var body struct {
+		Value []FederatedIdentityCredential `json:"value"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	return body.Value, nil
+}
+
+// Returns the subject TFC presents for a run phase. Federated credentials
+// do not support wildcards, so each workspace needs its own credentials.
+func getFederatedSubject(org string, workspace string, phase string) string {
+	return fmt.Sprintf("organization:%s:project:%s:workspace:%s:run_phase:%s", org, iac.PreviewProject, workspace, phase)
+}
+
+func runDoctor(ctx context.Context, configmap *config.Configuration, workspace string) []doctorCheck {
+
+	var checks []doctorCheck
+
+	checks = append(checks, doctorCheck{
+		name:   "Dynamic provider credentials enabled",
+		passed: iac.DynamicCredentials(configmap),
+		detail: "Set TFC_AZURE_PROVIDER_AUTH to 'true'",
+	})
+
+	client_id := configmap.List["TFC_AZURE_RUN_CLIENT_ID"].Value
+	if len(client_id) == 0 {
+		client_id = configmap.List["ARM_CLIENT_ID"].Value
+	}
+	checks = append(checks, doctorCheck{
+		name:   "Run client ID configured",
+		passed: len(client_id) != 0,
+		detail: "Set TFC_AZURE_RUN_CLIENT_ID to the application (client) ID",
+	})
+	if len(client_id) == 0 {
+		return checks
+	}
+
+	fics, err := getFederatedIdentityCredentials(ctx, client_id)
+	if err != nil {
+		return append(checks, doctorCheck{
+			name:   "Federated identity credentials readable",
+			detail: err.Error(),
+		})
+	}
+
+	issuer := "https://" + iac.Hostname(configmap)
+	audience := configmap.List["TFC_AZURE_WORKLOAD_IDENTITY_AUDIENCE"].Value
+	if len(audience) == 0 {
+		audience = iac.DefaultAzureAudience
+	}
+
+	org := iac.Organization(configmap)
+	for _, phase := range []string{"plan", "apply"} {
+		subject := getFederatedSubject(org, workspace, phase)
+		check := doctorCheck{
+			name:   "Federated credential for run phase '" + phase + "'",
+			detail: fmt.Sprintf("No credential with issuer '%s', audience '%s' and subject '%s'", issuer, audience, subject),
+		}
+		for _, fic := range fics {
+			if fic.Issuer != issuer || !slices.Contains(fic.Audiences, audience) {
+				continue
+			}
+			if fic.Subject == subject {
+				check.passed = true
+				break
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func getDoctorCommand() *cli.Command {
+
+	var (
+		service   string
+		workspace string
+	)
+
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "Verifies Azure dynamic provider credentials are configured for previews",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "service",
+				Usage:       "The name of the service to check.",
+				Destination: &service,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "workspace",
+				Usage:       "The Terraform Workspace whose credentials are checked.",
+				Destination: &workspace,
+				Required:    true,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+
+			configmap, err := getConfiguration("start", service)
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, check := range runDoctor(ctx.Context, configmap, workspace) {
+				if check.passed {
+					fmt.Printf("[PASS] %s\n", check.name)
+				} else {
+					fmt.Printf("[FAIL] %s: %s\n", check.name, check.detail)
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d check(s) failed", failed)
+			}
+			return nil
+		},
+		CustomHelpTemplate: get_help_text("doctor"),
+		HideHelpCommand:    true,
+	}
+}
@@ -0,0 +1,80 @@
+package preview_command
+
+import (
+	"fmt"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func getExtendCommand() *cli.Command {
+
+	var (
+		selector workspaceSelector
+		by       time.Duration
+	)
+
+	return &cli.Command{
+		Name:  "extend",
+		Usage: "Extends the expiration of a preview",
+		Flags: append(getSelectorFlags(&selector, true),
+			&cli.DurationFlag{
+				Name:        "by",
+				Usage:       "How long to extend the preview by (e.g. 24h).",
+				Destination: &by,
+				Required:    true,
+				Action: func(ctx *cli.Context, by time.Duration) error {
+					if by <= 0 {
+						return fmt.Errorf("value '%s' not supported. Must be greater than 0", by)
+					}
+					return nil
+				},
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+
+			// The service is read from the workspace when it is not given, as
+			// its labels hold the MAX_TTL used by preview start
+			service := selector.service
+			if len(service) == 0 {
+				configmap, err := getConfiguration("start", "")
+				if err != nil {
+					return err
+				}
+				setSelector(configmap, &selector)
+
+				wsDirector := iac.NewDirector(iac.GetBuilder(getBackend(configmap)))
+				if err := wsDirector.Find(ctx.Context, configmap); err != nil {
+					return err
+				}
+				found, err := wsDirector.WorkspaceService()
+				if err != nil {
+					return fmt.Errorf("failed to read the service of workspace '%s': %w. Use --service instead", wsDirector.WorkspaceName(), err)
+				}
+				service = found
+				selector = workspaceSelector{workspace: wsDirector.WorkspaceName()}
+			}
+
+			configmap, err := getConfiguration("start", service)
+			if err != nil {
+				return err
+			}
+
+			// Append Flags to ConfigMap
+			setSelector(configmap, &selector)
+			configmap.List["SERVICE"] = config.KeyValue{
+				Name:        "service",
+				Value:       service,
+				ContentType: "text/plain",
+			}
+
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			return runError(wsDirector.Extend(ctx.Context, configmap, by))
+		},
+		CustomHelpTemplate: get_help_text("extend"),
+		HideHelpCommand:    true,
+	}
+}
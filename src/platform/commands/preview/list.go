@@ -0,0 +1,288 @@
+package preview_command
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// One row per preview, summarizing the resources tagged with its workspace.
+const previewsQuery = "Resources | where tags['ExpirationDate']!='' and tags['TerraformCloud']!='' | extend workspace = tostring(tags.TerraformCloud), expiration = tolong(tags.ExpirationDate), service = tostring(tags.Service), owner = tostring(tags.Owner) | summarize expiration = max(expiration), resources = count(), locations = make_set_if(location, location !in ('', 'global')), service = max(service), owner = max(owner) by workspace"
+
+// Preview as reported by the Resource Graph API.
+type previewRow struct {
+	Workspace  string    `json:"workspace"`
+	Service    string    `json:"service"`
+	Locations  []string  `json:"locations"`
+	Owner      string    `json:"owner"`
+	Expiration time.Time `json:"expiration"`
+	Remaining  string    `json:"remaining"`
+	Resources  int       `json:"resources"`
+}
+
+// Returns the time left before the preview expires, or 'expired'.
+func getRemaining(expiration time.Time, now time.Time) string {
+	if !expiration.After(now) {
+		return "expired"
+	}
+	return expiration.Sub(now).Round(time.Minute).String()
+}
+
+func getPreviewRows(rows []map[string]interface{}, now time.Time) []previewRow {
+
+	var previews []previewRow
+	for _, row := range rows {
+		p := previewRow{Locations: []string{}}
+		p.Workspace, _ = row["workspace"].(string)
+		p.Service, _ = row["service"].(string)
+		p.Owner, _ = row["owner"].(string)
+		if seconds, ok := row["expiration"].(float64); ok {
+			p.Expiration = time.Unix(int64(seconds), 0).UTC()
+		}
+		if count, ok := row["resources"].(float64); ok {
+			p.Resources = int(count)
+		}
+		if locations, ok := row["locations"].([]interface{}); ok {
+			for _, l := range locations {
+				if location, ok := l.(string); ok {
+					p.Locations = append(p.Locations, location)
+				}
+			}
+			sort.Strings(p.Locations)
+		}
+		if len(p.Workspace) == 0 {
+			continue
+		}
+		p.Remaining = getRemaining(p.Expiration, now)
+		previews = append(previews, p)
+	}
+	return previews
+}
+
+// Keeps the previews matching every filter that is set.
+func filterPreviewRows(previews []previewRow, status string, service string, owner string, location string, now time.Time) []previewRow {
+
+	var filtered []previewRow
+	for _, p := range previews {
+		switch {
+		case status == "active" && !p.Expiration.After(now):
+		case status == "expired" && p.Expiration.After(now):
+		case len(service) != 0 && p.Service != service:
+		case len(owner) != 0 && !strings.EqualFold(p.Owner, owner):
+		case len(location) != 0 && !slices.Contains(p.Locations, location):
+		default:
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func sortPreviewRows(previews []previewRow, by string) {
+
+	less := map[string]func(a, b previewRow) bool{
+		"workspace":  func(a, b previewRow) bool { return a.Workspace < b.Workspace },
+		"service":    func(a, b previewRow) bool { return a.Service < b.Service },
+		"owner":      func(a, b previewRow) bool { return a.Owner < b.Owner },
+		"location":   func(a, b previewRow) bool { return strings.Join(a.Locations, ",") < strings.Join(b.Locations, ",") },
+		"expiration": func(a, b previewRow) bool { return a.Expiration.Before(b.Expiration) },
+		"resources":  func(a, b previewRow) bool { return a.Resources > b.Resources },
+	}[by]
+
+	sort.SliceStable(previews, func(i, j int) bool {
+		if less(previews[i], previews[j]) {
+			return true
+		}
+		if less(previews[j], previews[i]) {
+			return false
+		}
+		return previews[i].Workspace < previews[j].Workspace
+	})
+}
+
+func printPreviewRows(previews []previewRow, format string) error {
+
+	header := []string{"WORKSPACE", "SERVICE", "LOCATION", "OWNER", "EXPIRATION", "REMAINING", "RESOURCES"}
+	fields := func(p previewRow) []string {
+		return []string{
+			p.Workspace,
+			p.Service,
+			strings.Join(p.Locations, ","),
+			p.Owner,
+			p.Expiration.Format(time.RFC3339),
+			p.Remaining,
+			strconv.Itoa(p.Resources),
+		}
+	}
+
+	switch format {
+	case "json":
+		if previews == nil {
+			previews = []previewRow{}
+		}
+		// Same envelope as before rows were grouped by preview, for scripts
+		val, err := json.Marshal(map[string]interface{}{
+			"count": len(previews),
+			"data":  previews,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %w", err)
+		}
+		fmt.Println(string(val))
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		for _, p := range previews {
+			w.Write(fields(p))
+		}
+		w.Flush()
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, p := range previews {
+			fmt.Fprintln(w, strings.Join(fields(p), "\t"))
+		}
+		return w.Flush()
+	}
+
+	return nil
+}
+
+func getListCommand() *cli.Command {
+
+	var (
+		status   string
+		service  string
+		owner    string
+		location string
+		sort_by  string
+		output   string
+		mine     bool
+	)
+
+	return &cli.Command{
+		Name:  "list",
+		Usage: "Returns list of previews currently hosted in the Cloud.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "status",
+				Usage:       "Status of current preview resources in Azure (e.g. active, expired). Default: every preview.",
+				Destination: &status,
+				Required:    false,
+				Action: func(ctx *cli.Context, status string) error {
+					supported := []string{
+						"active",
+						"expired",
+					}
+
+					if !slices.Contains(supported, status) {
+						return fmt.Errorf("value '%s' not supported", status)
+					}
+
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:        "service",
+				Usage:       "Only list previews of this service",
+				Destination: &service,
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "owner",
+				Usage:       "Only list previews owned by this user",
+				Destination: &owner,
+				Required:    false,
+			},
+			&cli.BoolFlag{
+				Name:        "mine",
+				Usage:       "Only list previews owned by you: the user who triggered the CI run, or the identity signed in to Azure.",
+				Destination: &mine,
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "location",
+				Usage:       "Only list previews with resources in this Azure Region",
+				Destination: &location,
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "sort",
+				Usage:       "Sort by workspace, service, location, owner, expiration or resources.",
+				Destination: &sort_by,
+				Value:       "expiration",
+				Required:    false,
+				Action: func(ctx *cli.Context, sort_by string) error {
+					supported := []string{
+						"workspace",
+						"service",
+						"location",
+						"owner",
+						"expiration",
+						"resources",
+					}
+
+					if !slices.Contains(supported, sort_by) {
+						return fmt.Errorf("value '%s' not supported. Allowed Value: %v", sort_by, supported)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       "Output format.  Allowed values: json, table, csv.  Default: json.",
+				Destination: &output,
+				Value:       "json",
+				Required:    false,
+				Action: func(ctx *cli.Context, output string) error {
+					supported := []string{
+						"json",
+						"table",
+						"csv",
+					}
+
+					if !slices.Contains(supported, output) {
+						return fmt.Errorf("value '%s' not supported. Allowed Value: %v", output, supported)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+
+			// Only the Resource Graph scope is configured, so an Azure login is enough
+			configmap, err := getOptionalConfiguration("list")
+			if err != nil {
+				return err
+			}
+
+			owner, err := getOwnerFilter(ctx.Context, owner, mine)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			rows, err := queryResourceGraph(ctx.Context, configmap, previewsQuery)
+			if err != nil {
+				return err
+			}
+
+			previews := getPreviewRows(rows, now)
+			previews = filterPreviewRows(previews, status, service, owner, location, now)
+			sortPreviewRows(previews, sort_by)
+
+			return printPreviewRows(previews, output)
+		},
+		CustomHelpTemplate: get_help_text("list"),
+		HideHelpCommand:    true,
+	}
+}
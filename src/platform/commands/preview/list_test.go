@@ -0,0 +1,122 @@
+package preview_command
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetPreviewRows(t *testing.T) {
+
+	now := time.Unix(1700000000, 0).UTC()
+	rows := []map[string]interface{}{
+		{
+			"workspace":  "api-1a2b3c4d-dev-eastus",
+			"service":    "api",
+			"owner":      "jane",
+			"expiration": float64(now.Add(90 * time.Minute).Unix()),
+			"resources":  float64(3),
+			"locations":  []interface{}{"westus", "eastus"},
+		},
+		{
+			"workspace":  "web-5e6f7a8b-dev-eastus",
+			"expiration": float64(now.Add(-time.Hour).Unix()),
+			"resources":  float64(1),
+		},
+		{"service": "api", "resources": float64(2)},
+	}
+
+	previews := getPreviewRows(rows, now)
+	if len(previews) != 2 {
+		t.Fatalf("got %d previews, want rows without a workspace skipped", len(previews))
+	}
+
+	api := previews[0]
+	if api.Service != "api" || api.Owner != "jane" || api.Resources != 3 {
+		t.Errorf("got %+v", api)
+	}
+	if strings.Join(api.Locations, ",") != "eastus,westus" {
+		t.Errorf("got locations %v, want them sorted", api.Locations)
+	}
+	if !api.Expiration.Equal(now.Add(90*time.Minute)) || api.Remaining != "1h30m0s" {
+		t.Errorf("got expiration %v remaining %s", api.Expiration, api.Remaining)
+	}
+
+	web := previews[1]
+	if web.Remaining != "expired" || web.Locations == nil || len(web.Locations) != 0 {
+		t.Errorf("got %+v, want an expired preview with no locations", web)
+	}
+}
+
+func TestFilterPreviewRows(t *testing.T) {
+
+	now := time.Unix(1700000000, 0).UTC()
+	previews := []previewRow{
+		{Workspace: "api-dev", Service: "api", Owner: "Jane", Locations: []string{"eastus"}, Expiration: now.Add(time.Hour)},
+		{Workspace: "api-old", Service: "api", Owner: "john", Locations: []string{"westus"}, Expiration: now.Add(-time.Hour)},
+		{Workspace: "web-dev", Service: "web", Owner: "jane", Locations: []string{"eastus", "westus"}, Expiration: now},
+	}
+
+	cases := []struct {
+		name     string
+		status   string
+		service  string
+		owner    string
+		location string
+		want     string
+	}{
+		{"no filters", "", "", "", "", "api-dev api-old web-dev"},
+		{"active", "active", "", "", "", "api-dev"},
+		{"expired", "expired", "", "", "", "api-old web-dev"},
+		{"service", "", "api", "", "", "api-dev api-old"},
+		{"owner ignores case", "", "", "jane", "", "api-dev web-dev"},
+		{"location", "", "", "", "westus", "api-old web-dev"},
+		{"every filter", "expired", "web", "JANE", "eastus", "web-dev"},
+		{"no match", "active", "web", "", "", ""},
+	}
+
+	for _, c := range cases {
+		var got []string
+		for _, p := range filterPreviewRows(previews, c.status, c.service, c.owner, c.location, now) {
+			got = append(got, p.Workspace)
+		}
+		if strings.Join(got, " ") != c.want {
+			t.Errorf("%s: got %v, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSortPreviewRows(t *testing.T) {
+
+	now := time.Unix(1700000000, 0).UTC()
+	previews := []previewRow{
+		{Workspace: "c", Service: "web", Owner: "amy", Locations: []string{"westus"}, Expiration: now.Add(2 * time.Hour), Resources: 1},
+		{Workspace: "a", Service: "api", Owner: "bob", Locations: []string{"eastus"}, Expiration: now.Add(3 * time.Hour), Resources: 5},
+		{Workspace: "b", Service: "api", Owner: "amy", Locations: []string{"eastus", "westus"}, Expiration: now.Add(time.Hour), Resources: 5},
+	}
+
+	cases := []struct {
+		by   string
+		want string
+	}{
+		{"workspace", "a b c"},
+		{"service", "a b c"},
+		{"owner", "b c a"},
+		{"location", "a b c"},
+		{"expiration", "b c a"},
+		{"resources", "a b c"},
+	}
+
+	for _, c := range cases {
+		sorted := append([]previewRow(nil), previews...)
+		sortPreviewRows(sorted, c.by)
+
+		var got []string
+		for _, p := range sorted {
+			got = append(got, p.Workspace)
+		}
+		if strings.Join(got, " ") != c.want {
+			t.Errorf("%s: got %v, want %s", c.by, got, c.want)
+		}
+	}
+}
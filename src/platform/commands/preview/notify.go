@@ -0,0 +1,118 @@
+package preview_command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// Used when NOTIFY_TEMPLATE is not configured.
+const defaultNotifyTemplate = `{{if .Service}}{{.Service}} {{end}}preview '{{.Workspace}}' {{if eq .Status "succeeded"}}{{if eq .Command "start"}}is ready{{else}}was stopped{{end}}{{else}}failed to {{.Command}}{{end}}{{if .URL}}: {{.URL}}{{end}}{{if .Error}}
+{{.Error}}{{end}}{{range .Outputs}}
+{{.Name}}: {{.String}}{{end}}`
+
+// Posted to NOTIFY_WEBHOOK when start or stop completes. Text is rendered
+// from NOTIFY_TEMPLATE, so Slack and Teams incoming webhooks can show it.
+type notification struct {
+	Text      string       `json:"text"`
+	Command   string       `json:"command"`
+	Service   string       `json:"service,omitempty"`
+	Workspace string       `json:"workspace"`
+	Status    string       `json:"status"`
+	URL       string       `json:"url,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Outputs   []iac.Output `json:"outputs,omitempty"`
+}
+
+// Reports the outcome of a start or stop to the service's webhook, if one is
+// configured. Sensitive outputs are masked. Failing to notify only warns.
+func notify(ctx context.Context, configmap *config.Configuration, command string, wsDirector *iac.IacDirector, result error) {
+
+	webhook := configmap.List["NOTIFY_WEBHOOK"].Value
+	if len(webhook) == 0 {
+		return
+	}
+
+	n := notification{
+		Command:   command,
+		Service:   configmap.List["SERVICE"].Value,
+		Workspace: wsDirector.WorkspaceName(),
+		Status:    "succeeded",
+	}
+	if result != nil {
+		n.Status = "failed"
+		n.Error = result.Error()
+	} else if command == "start" {
+		status, err := wsDirector.RunStatus(ctx)
+		if err != nil {
+			ci.Warning("Failed to read status for notification: %v", err)
+		}
+		n.URL = status.URL
+		n.Outputs = status.Outputs
+	}
+
+	if err := sendNotification(ctx, webhook, configmap.List["NOTIFY_TEMPLATE"].Value, n); err != nil {
+		ci.Warning("Failed to send notification: %v", err)
+		return
+	}
+	ci.Info("Notification sent")
+}
+
+func sendNotification(ctx context.Context, webhook string, tmpl string, n notification) error {
+
+	if len(tmpl) == 0 {
+		tmpl = defaultNotifyTemplate
+	}
+	t, err := template.New("notification").Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("invalid NOTIFY_TEMPLATE: %w", err)
+	}
+	var text bytes.Buffer
+	if err := t.Execute(&text, n); err != nil {
+		return fmt.Errorf("invalid NOTIFY_TEMPLATE: %w", err)
+	}
+	n.Text = text.String()
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return hideURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return hideURL(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded '%s'", res.Status)
+	}
+	return nil
+}
+
+// Webhook URLs are secrets, so they are left out of errors that get logged.
+func hideURL(err error) error {
+	var url_err *url.Error
+	if errors.As(err, &url_err) {
+		return url_err.Err
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package preview_command
+
+import (
+	"encoding/json"
+	"fmt"
+	iac "main/interfaces/iac"
+	"slices"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+func printOutputs(outputs []iac.Output, format string, show_sensitive bool) error {
+
+	if !show_sensitive {
+		for i := range outputs {
+			outputs[i] = outputs[i].Masked()
+		}
+	}
+
+	switch format {
+	case "json":
+		val, err := json.MarshalIndent(outputs, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %w", err)
+		}
+		fmt.Println(string(val))
+	case "env":
+		var lines []string
+		for _, output := range outputs {
+			line, err := output.Env()
+			if err != nil {
+				return fmt.Errorf("%w. Use --output json or yaml instead", err)
+			}
+			lines = append(lines, line)
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	case "yaml":
+		val, err := yaml.Marshal(outputs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YAML output: %w", err)
+		}
+		fmt.Print(string(val))
+	}
+
+	return nil
+}
+
+func getOutputsCommand() *cli.Command {
+
+	var (
+		selector       workspaceSelector
+		output         string
+		show_sensitive bool
+	)
+
+	return &cli.Command{
+		Name:  "outputs",
+		Usage: "Returns the Terraform outputs of a preview",
+		Flags: append(getSelectorFlags(&selector, true),
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       "Output format.  Allowed values: env, json, yaml.  Default: json.",
+				Destination: &output,
+				Value:       "json",
+				Required:    false,
+				Action: func(ctx *cli.Context, output string) error {
+
+					supported := []string{
+						"env",
+						"json",
+						"yaml",
+					}
+
+					if !slices.Contains(supported, output) {
+						return fmt.Errorf("value '%s' not supported. Allowed Value: %v", output, supported)
+					}
+
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:        "show-sensitive",
+				Usage:       "Print the values of sensitive outputs instead of masking them.",
+				Destination: &show_sensitive,
+				Required:    false,
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+
+			configmap, err := getConfiguration("outputs", "")
+			if err != nil {
+				return err
+			}
+
+			// Append Flags to ConfigMap
+			setSelector(configmap, &selector)
+
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			outputs, err := wsDirector.Outputs(ctx.Context, configmap)
+			if err != nil {
+				return err
+			}
+
+			return printOutputs(outputs, output, show_sensitive)
+		},
+		CustomHelpTemplate: get_help_text("outputs"),
+		HideHelpCommand:    true,
+	}
+}
@@ -0,0 +1,53 @@
+package preview_command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iac "main/interfaces/iac"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Returns who is running the command: the user who triggered the CI run,
+// otherwise the identity of the Azure credential.
+func detectOwner(ctx context.Context) (string, error) {
+
+	if owner := iac.OwnerFromEnvironment(os.Getenv); len(owner) != 0 {
+		return owner, nil
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{
+		Scopes: []string{managementEndpoint + "/.default"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return iac.OwnerFromToken(token.Token)
+}
+
+// Returns the owner previews are filtered by: the --owner value, or the
+// caller when --mine is set.
+func getOwnerFilter(ctx context.Context, owner string, mine bool) (string, error) {
+
+	if !mine {
+		return owner, nil
+	}
+	if len(owner) != 0 {
+		return "", errors.New("--mine cannot be combined with --owner")
+	}
+
+	owner, err := detectOwner(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine who you are, use --owner instead: %w", err)
+	}
+	return owner, nil
+}
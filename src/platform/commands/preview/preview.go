@@ -1,18 +1,17 @@
 package preview_command
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	ci "main/interfaces/ci"
 	config "main/interfaces/configuration"
 	iac "main/interfaces/iac"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
 	"github.com/urfave/cli/v2"
 )
 
@@ -37,12 +36,60 @@ func get_help_text(category string) string {
 Options:
 	{{range .Subcommands }}
 	{{range $index, $option := .Names }}{{if $index}}{{end}}{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+Global options (use these before the subcommand):
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
 `
 	case "start":
 		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
 
 	Creates infrastructure according to Terraform configuration
 	files located in a GitHub Repository.
+
+	Pressing Ctrl-C while the run is in progress offers to cancel the
+	run in Terraform Cloud instead of leaving it running.
+
+	Workspaces are named after the service, branch or pull request,
+	environment and location. Running start again for the same preview
+	queues a new run in the existing workspace instead of creating a
+	new one.
+
+	When start creates a workspace and its run fails, the workspace is
+	rolled back: resources that were applied are destroyed and the
+	workspace is deleted. Use --keep-on-failure to leave it in place for
+	debugging. Existing workspaces are never rolled back.
+
+	Use --file instead of --service to start a stack of services from a
+	preview manifest. Each service is started in its own workspace after
+	the services it depends on, and the outputs named by its inputs are
+	passed to it as Terraform variables through the 'tfvar:' and
+	'tfvar-hcl:' keys, which its TFC_VARIABLES must map:
+
+	  services:
+	    - name: networking
+	    - name: database
+	      depends_on: [networking]
+	      inputs:
+	        subnet_id: networking.subnet_id
+
+	Repeat --location to start the preview in several regions at once,
+	with one workspace per region. Progress of each region is prefixed
+	with its name, and once every region finished the outputs are
+	published keyed by region. When a region fails, the regions that
+	succeeded are rolled back too, unless --keep-on-failure is set.
+
+	A new preview belongs to whoever started it: the user who triggered
+	the CI run, otherwise the identity signed in to Azure, unless --owner
+	is given. The owner is written to an 'owner:' workspace tag and the
+	OWNER Terraform variable, which Terraform should copy into the
+	'Owner' tag of its resources.
+
+	New workspaces are refused once the preview project holds as many
+	previews as MAX_PREVIEWS_PER_SERVICE, MAX_PREVIEWS_PER_OWNER or
+	MAX_PREVIEWS allow. The previews counted are listed so one can be
+	stopped. Callers listed in QUOTA_ADMINS may pass --override-quota to
+	create it anyway. The caller is detected as for the owner, ignoring
+	--owner.
 	
 	Platform will require that you 'Sign into Azure' using the Azure CLI to 
 	retrieve the required Terraform Cloud API token and any other additional  
@@ -58,6 +105,28 @@ Options:
 
 	Tears down infrastructure according to Terraform configuration
 	files located in a GitHub Repository.
+
+	Pressing Ctrl-C while the run is in progress offers to cancel the
+	run in Terraform Cloud instead of leaving it running.
+
+	--workspace matches a workspace by its exact name or ID. Without it,
+	or when no such workspace exists, the preview is found by the tags
+	of its workspace using --service, --branch, --owner, --location and
+	--tag. When several previews match, you are asked to choose one.
+	Without --service, the service is read from the workspace tags so
+	the NOTIFY_WEBHOOK of its label is used.
+
+	With --all, every preview matching the selectors is stopped instead.
+	The previews are listed and must be confirmed, or --yes given when
+	there is no terminal to confirm on. They are then destroyed and
+	deleted in parallel, up to --parallelism at once.
+
+	With --file, every service of a preview manifest is stopped, in the
+	reverse order they were started. The previews are found by the tags
+	given with --branch, --owner, --location or --tag.
+
+	--mine selects the previews you own, like --owner does for someone
+	else's.
 	
 	Platform will require that you 'Sign into Azure' using the Azure CLI to 
 	retrieve the required Terraform Cloud API token and any other additional  
@@ -79,6 +148,167 @@ Options:
 	to be returned, they must be assigned the 'TerraformCloud' and
     'ExpirationDate' tags.
 
+	Each preview is listed once, with the number of its resources and the
+	regions they are in. The service and owner are read from the
+	'Service' and 'Owner' tags of its resources. Without --status, every
+	preview is listed. Use --mine to list only the previews you own.
+
+	Without APP_CONFIG_STORE, only an Azure login is needed: the query is
+	scoped by --subscription or --management-group, then the
+	AZURE_MANAGEMENT_GROUP environment variable, then every subscription
+	you can read.
+
+	--output json, the default, prints '{"count": N, "data": [...]}' with
+	one row per preview holding its workspace, service, locations, owner,
+	expiration, remaining time and resources. --output table and csv
+	print the same columns for people and spreadsheets.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "doctor":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Verifies that previews can authenticate to Azure using Terraform Cloud
+	dynamic provider credentials.
+
+	The app registration named by TFC_AZURE_RUN_CLIENT_ID must have a
+	federated identity credential for the plan and apply run phases of the
+	workspace. Subjects must match exactly, as Azure does not support
+	wildcards (e.g. 'organization:my-org:project:preview:workspace:<name>:run_phase:apply').
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "outputs":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Returns the outputs of a preview's current Terraform state.
+
+	Values of any type are supported. Strings are printed as-is and all
+	other types are JSON encoded. Sensitive outputs are masked unless
+	--show-sensitive is set. With '--output env', values are quoted for
+	the shell and outputs spanning several lines are rejected.
+
+	--workspace matches a workspace by its exact name or ID. Without it,
+	or when no such workspace exists, the preview is found by the tags
+	of its workspace using --service, --branch, --owner, --location and
+	--tag. When several previews match, you are asked to choose one.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "extend":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Extends the expiration of a preview and queues a new run so the
+	ExpirationDate tag is re-applied to its Azure resources.
+
+	The new expiration cannot exceed the service's MAX_TTL configuration.
+	Without --service, the service is read from the workspace's tags.
+
+	--workspace matches a workspace by its exact name or ID. Without it,
+	or when no such workspace exists, the preview is found by the tags
+	of its workspace using --service, --branch, --owner, --location and
+	--tag. When several previews match, you are asked to choose one.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "reap":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Destroys every preview that expired more than the grace period ago.
+
+	Expired previews are found using the expiration tag of workspaces in
+	the Terraform Cloud preview project and the 'ExpirationDate' tag of
+	resources returned by the Resource Graph API. Workspaces outside of
+	the preview project are never destroyed. Use --owner or --mine to
+	only destroy the previews of a single owner.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "cancel":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Cancels the in-flight run of a preview. When --workspace is used,
+	the latest run of the workspace is canceled.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "discard":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Discards a run of a preview that is waiting for confirmation. When
+	--workspace is used, the latest run of the workspace is discarded.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "lock":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Locks the workspace of a preview so no new runs can be queued.
+	When --run is used, the workspace of the run is locked.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "unlock":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Unlocks the workspace of a preview. When --run is used, the
+	workspace of the run is unlocked.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "status":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Shows a single preview in detail, including its workspace, branch or
+	commit, latest run, resource count, outputs, expiration, owner and
+	lock state. Sensitive outputs are masked.
+
+	--workspace matches a workspace by its exact name or ID. Without it,
+	or when no such workspace exists, the preview is found by the tags
+	of its workspace using --service, --branch, --owner, --location and
+	--tag. When several previews match, you are asked to choose one.
+
+Options:
+	{{range .VisibleFlags }}
+	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
+`
+	case "audit":
+		help = `Usage: platform preview {{if .VisibleFlags}}[global options]{{end}} {{if .Name}}{{ .Name }}{{end}} [options]
+
+	Cross-references resources returned by the Resource Graph API with
+	the workspaces in the Terraform Cloud preview project, and reports:
+
+	  orphaned-resources       resources tagged with a workspace that no
+	                           longer exists in the organization
+	  orphaned-resource-group  resource groups tagged with a workspace
+	                           that no longer exists in the organization
+	  empty-workspace          workspaces older than --min-age with no
+	                           resources left in Azure
+	  errored-run              workspaces whose latest run errored
+
+	--fix deletes orphaned resource groups holding nothing but resources
+	of their workspace, and empty workspaces with no resources in state.
+	Everything else is only reported. --fix is refused with the local
+	backend, whose workspaces are only known to the machine that ran them.
+
 Options:
 	{{range .VisibleFlags }}
 	{{range $index, $option := .Names }}{{if $index}}{{end}}--{{$option}}{{end}}{{ "\t\t"}}{{.Usage}}{{end}}{{ "\n" }}
@@ -89,21 +319,230 @@ Options:
 
 }
 
+// Configuration set by the preview command's flags, applied over the
+// configuration of every subcommand.
+var overrides = make(map[string]config.KeyValue)
+
+// Returns configuration from the App Configuration Store for a preview
+// subcommand, layering labels from least to most specific.
+func getConfiguration(subcommand string, service string) (*config.Configuration, error) {
+
+	// App Config Store
+	endpoint := os.Getenv("APP_CONFIG_STORE")
+
+	// Create Labels from Commands
+	labels := []string{
+		"platform-preview",
+		"platform-preview-" + subcommand,
+	}
+	if len(service) != 0 {
+		labels = append(labels, "platform-preview-"+subcommand+"-"+service)
+	}
+
+	configBuilder := config.GetBuilder("azconfig.io")
+	configDirector := config.NewDirector(configBuilder)
+	configmap, err := configDirector.Build(endpoint, labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration from '%s': %w", endpoint, err)
+	}
+
+	for key, value := range overrides {
+		configmap.List[key] = value
+	}
+
+	return configmap, nil
+}
+
+// Like getConfiguration, but only the preview command's flags apply when no
+// App Configuration Store is set, for subcommands that need nothing else.
+func getOptionalConfiguration(subcommand string) (*config.Configuration, error) {
+
+	if len(os.Getenv("APP_CONFIG_STORE")) != 0 {
+		return getConfiguration(subcommand, "")
+	}
+
+	configmap := &config.Configuration{List: make(map[string]config.KeyValue)}
+	for key, value := range overrides {
+		configmap.List[key] = value
+	}
+	return configmap, nil
+}
+
+// Returns a copy of the configuration that can be changed independently.
+func copyConfiguration(configmap *config.Configuration) *config.Configuration {
+
+	list := make(map[string]config.KeyValue, len(configmap.List))
+	for key, value := range configmap.List {
+		list[key] = value
+	}
+	return &config.Configuration{List: list}
+}
+
+// Returns the backend type previews run on: 'tfc' (default), 'tfe' or
+// 'local'.
+func getBackend(configmap *config.Configuration) string {
+
+	backend := configmap.List["IAC_BACKEND"].Value
+	if len(backend) == 0 {
+		return "tfc"
+	}
+	return backend
+}
+
+// Returns the preview command's flags for the overrides in effect, so child
+// processes run against the same backend.
+func getOverrideArgs() []string {
+
+	flags := map[string]string{
+		"IAC_BACKEND":             "--backend",
+		"TFC_HOSTNAME":            "--hostname",
+		"TFC_CA_BUNDLE":           "--ca-bundle",
+		"AZURE_SUBSCRIPTIONS":     "--subscription",
+		"AZURE_MANAGEMENT_GROUPS": "--management-group",
+	}
+
+	var args []string
+	for key, flag := range flags {
+		if value, ok := overrides[key]; ok {
+			args = append(args, flag, value.Value)
+		}
+	}
+	return args
+}
+
+// Child processes report to a terminal, so their output can be prefixed or
+// grouped by the parent.
+func getChildEnv() []string {
+	return append(os.Environ(), ci.ProviderVariable+"=plain")
+}
+
+// Services that can be previewed, with --service or in a manifest.
+var supportedServices = []string{
+	"my-app",
+}
+
+// Interrupted runs that were left running exit like an interrupted process.
+func runError(err error) error {
+	if errors.Is(err, iac.ErrInterrupted) {
+		return cli.Exit("", 130)
+	}
+	return err
+}
+
 func GetCommand() *cli.Command {
 
 	// Placeholders
 	var (
-		service     string
-		environment string
-		location    string
-		workspace   string
-		status      string
+		service           string
+		environment       string
+		locations         cli.StringSlice
+		max_monthly_cost  float64
+		branch            string
+		pull_request      string
+		ttl               time.Duration
+		backend           string
+		hostname          string
+		ca_bundle         string
+		subscriptions     cli.StringSlice
+		management_groups cli.StringSlice
+		keep_on_failure   bool
+		manifest          string
+		owner             string
+		override_quota    bool
 	)
 
 	command := &cli.Command{
 		Name:  "preview",
 		Usage: "Used for managing Ephemeral infrastructure",
-		Subcommands: []*cli.Command{
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "backend",
+				Usage:       "Where previews run. Allowed values: tfc, tfe, local. Overrides IAC_BACKEND.",
+				Destination: &backend,
+				EnvVars:     []string{"PLATFORM_IAC_BACKEND"},
+				Required:    false,
+				Action: func(ctx *cli.Context, backend string) error {
+					supported := []string{
+						"tfc",
+						"tfe",
+						"local",
+					}
+
+					if !slices.Contains(supported, backend) {
+						return fmt.Errorf("value '%s' not supported. Allowed Value: %v", backend, supported)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:        "hostname",
+				Usage:       "Hostname of Terraform Enterprise. Overrides TFC_HOSTNAME.",
+				Destination: &hostname,
+				EnvVars:     []string{"PLATFORM_TFC_HOSTNAME"},
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "ca-bundle",
+				Usage:       "Path to PEM encoded CA certificates trusted for Terraform Enterprise. Overrides TFC_CA_BUNDLE.",
+				Destination: &ca_bundle,
+				EnvVars:     []string{"PLATFORM_TFC_CA_BUNDLE"},
+				Required:    false,
+			},
+			&cli.StringSliceFlag{
+				Name:        "subscription",
+				Usage:       "Subscription that Resource Graph queries are scoped to. Repeat for several. Overrides AZURE_SUBSCRIPTIONS.",
+				Destination: &subscriptions,
+				Required:    false,
+			},
+			&cli.StringSliceFlag{
+				Name:        "management-group",
+				Usage:       "Management group that Resource Graph queries are scoped to. Repeat for several. Overrides AZURE_MANAGEMENT_GROUPS.",
+				Destination: &management_groups,
+				Required:    false,
+			},
+		},
+		Before: func(ctx *cli.Context) error {
+
+			// Append Flags to Overrides
+			if ctx.IsSet("backend") {
+				overrides["IAC_BACKEND"] = config.KeyValue{
+					Name:        "backend",
+					Value:       backend,
+					ContentType: "text/plain",
+				}
+			}
+			if ctx.IsSet("hostname") {
+				overrides["TFC_HOSTNAME"] = config.KeyValue{
+					Name:        "hostname",
+					Value:       hostname,
+					ContentType: "text/plain",
+				}
+			}
+			if ctx.IsSet("ca-bundle") {
+				overrides["TFC_CA_BUNDLE"] = config.KeyValue{
+					Name:        "ca-bundle",
+					Value:       ca_bundle,
+					ContentType: "text/plain",
+				}
+			}
+			if ctx.IsSet("subscription") {
+				overrides["AZURE_SUBSCRIPTIONS"] = config.KeyValue{
+					Name:        "subscription",
+					Value:       strings.Join(subscriptions.Value(), ","),
+					ContentType: "text/plain",
+				}
+			}
+			if ctx.IsSet("management-group") {
+				overrides["AZURE_MANAGEMENT_GROUPS"] = config.KeyValue{
+					Name:        "management-group",
+					Value:       strings.Join(management_groups.Value(), ","),
+					ContentType: "text/plain",
+				}
+			}
+
+			return nil
+		},
+		Subcommands: append([]*cli.Command{
 			{
 				Name:  "start",
 				Usage: "Create and approve a generated plan in Terraform Cloud to stand up infrastructure",
@@ -112,20 +551,23 @@ func GetCommand() *cli.Command {
 						Name:        "service",
 						Usage:       "The name of the service to be provisioned.",
 						Destination: &service,
-						Required:    true,
+						Required:    false,
 						Action: func(ctx *cli.Context, service string) error {
 
-							supported := []string{
-								"my-app",
-							}
-
-							if !slices.Contains(supported, service) {
-								return fmt.Errorf("value '%s' not supported. Allowed Value: %v", service, supported)
+							if !slices.Contains(supportedServices, service) {
+								return fmt.Errorf("value '%s' not supported. Allowed Value: %v", service, supportedServices)
 							}
 
 							return nil
 						},
 					},
+					&cli.StringFlag{
+						Name:        "file",
+						Aliases:     []string{"f"},
+						Usage:       "Preview manifest listing several services to start together, instead of --service.",
+						Destination: &manifest,
+						Required:    false,
+					},
 					&cli.StringFlag{
 						Name:        "environment",
 						Usage:       "Where the service will be deployed.",
@@ -144,204 +586,266 @@ func GetCommand() *cli.Command {
 							return nil
 						},
 					},
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:        "location",
-						Usage:       "Azure Region",
-						Destination: &location,
+						Usage:       "Azure Region. Repeat to start the preview in several regions at once.",
+						Destination: &locations,
 						Required:    true,
-						Action: func(ctx *cli.Context, location string) error {
+						Action: func(ctx *cli.Context, locations []string) error {
 							supported := []string{
 								"southcentralus",
 								"centralus",
 							}
 
-							if !slices.Contains(supported, location) {
-								return fmt.Errorf("value '%s' not supported. Allowed Value: %v", location, supported)
+							for i, location := range locations {
+								if !slices.Contains(supported, location) {
+									return fmt.Errorf("value '%s' not supported. Allowed Value: %v", location, supported)
+								}
+								if slices.Contains(locations[:i], location) {
+									return fmt.Errorf("value '%s' is repeated", location)
+								}
 							}
 							return nil
 						},
 					},
+					&cli.StringFlag{
+						Name:        "branch",
+						Usage:       "Source branch of the preview. Used to derive a deterministic workspace name.",
+						Destination: &branch,
+						Required:    false,
+						EnvVars:     []string{"SYSTEM_PULLREQUEST_SOURCEBRANCH", "BUILD_SOURCEBRANCH", "GITHUB_HEAD_REF", "GITHUB_REF_NAME"},
+					},
+					&cli.StringFlag{
+						Name:        "pull-request",
+						Usage:       "Pull request number of the preview. Takes precedence over --branch when deriving the workspace name.",
+						Destination: &pull_request,
+						Required:    false,
+						EnvVars:     []string{"SYSTEM_PULLREQUEST_PULLREQUESTID"},
+					},
+					&cli.DurationFlag{
+						Name:        "ttl",
+						Usage:       "How long the preview lives before it expires (e.g. 48h). Defaults to the service's TTL configuration.",
+						Destination: &ttl,
+						Required:    false,
+					},
+					&cli.Float64Flag{
+						Name:        "max-monthly-cost",
+						Usage:       "Discard the run before apply when the estimated monthly cost (USD) exceeds this value, or when no cost estimate is available.",
+						Destination: &max_monthly_cost,
+						Required:    false,
+						Action: func(ctx *cli.Context, cost float64) error {
+							if cost <= 0 {
+								return fmt.Errorf("value '%v' not supported. Must be greater than 0", cost)
+							}
+							return nil
+						},
+					},
+					&cli.BoolFlag{
+						Name:        "keep-on-failure",
+						Usage:       "Keep a newly created preview when its run fails instead of destroying and deleting it.",
+						Destination: &keep_on_failure,
+						Required:    false,
+					},
+					&cli.StringFlag{
+						Name:        "owner",
+						Usage:       "Who the preview belongs to. Defaults to the user who triggered the CI run, then the identity signed in to Azure.",
+						Destination: &owner,
+						Required:    false,
+					},
+					&cli.BoolFlag{
+						Name:        "override-quota",
+						Usage:       "Create the preview even when it exceeds the preview quotas. Restricted to QUOTA_ADMINS.",
+						Destination: &override_quota,
+						Required:    false,
+					},
 				},
 				Action: func(ctx *cli.Context) error {
 
-					// App Config Store
-					endpoint := os.Getenv("APP_CONFIG_STORE")
-
-					// Create Labels from Coommands
-					var labels []string
-					full_command := strings.Split(ctx.Command.HelpName, " ")
-					labels = append(
-						labels,
-						full_command[0]+"-"+full_command[1], // e.g. platform-preview
-						full_command[0]+"-"+full_command[1]+"-"+full_command[2],             // e.g. platform-preview-start
-						full_command[0]+"-"+full_command[1]+"-"+full_command[2]+"-"+service, // e.g. platform-preview-start-service
-					)
-
-					configBuilder := config.GetBuilder("azconfig.io")
-					configDirector := config.NewDirector(configBuilder)
-					configmap := configDirector.Build(endpoint, labels)
-
-					// Append Flags to ConfigMap
-					configmap.List["SERVICE"] = config.KeyValue{
-						Name:        "service",
-						Value:       service,
-						ContentType: "text/plain",
-					}
-					configmap.List["ENVIRONMENT"] = config.KeyValue{
-						Name:        "environment",
-						Value:       environment,
-						ContentType: "text/plain",
+					// Attribute the preview to the caller
+					var caller string
+					if len(owner) == 0 || override_quota {
+						detected, err := detectOwner(ctx.Context)
+						if err != nil && override_quota {
+							return fmt.Errorf("failed to determine who is overriding the preview quotas: %w", err)
+						} else if err != nil {
+							ci.Warning("Failed to determine the owner of the preview: %v", err)
+						}
+						caller = detected
 					}
-					configmap.List["LOCATION"] = config.KeyValue{
-						Name:        "location",
-						Value:       location,
-						ContentType: "text/plain",
+					if len(owner) == 0 {
+						owner = caller
 					}
 
-					wsBuilder := iac.GetBuilder("app.terraform.io")
-					wsDirector := iac.NewDirector(wsBuilder)
-					wsDirector.Build(configmap)
-					wsDirector.Run()
+					// Returns the configuration of a service, with the flags applied
+					getStartConfiguration := func(service string) (*config.Configuration, error) {
 
-					return nil
-				},
-				CustomHelpTemplate: get_help_text("start"),
-				HideHelpCommand:    true,
-			},
-			{
-				Name:  "stop",
-				Usage: "Create and approve a generated plan in Terraform Cloud to tear down infrastructure",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:        "workspace",
-						Usage:       "Terraform Workspace",
-						Destination: &workspace,
-						Required:    true,
-					},
-				},
-				Action: func(ctx *cli.Context) error {
-
-					// App Config Store
-					endpoint := os.Getenv("APP_CONFIG_STORE")
-
-					// Create Labels from Coommands
-					var labels []string
-					full_command := strings.Split(ctx.Command.HelpName, " ")
-					labels = append(
-						labels,
-						full_command[0]+"-"+full_command[1], // e.g. platform-preview
-						full_command[0]+"-"+full_command[1]+"-"+full_command[2], // e.g. platform-preview-stop
-					)
-
-					configBuilder := config.GetBuilder("azconfig.io")
-					configDirector := config.NewDirector(configBuilder)
-					configmap := configDirector.Build(endpoint, labels)
-
-					// Append Flags to ConfigMap
-					configmap.List["TFC_WORKSPACE"] = config.KeyValue{
-						Name:        "workspace",
-						Value:       workspace,
-						ContentType: "text/plain",
-					}
+						configmap, err := getConfiguration("start", service)
+						if err != nil {
+							return nil, err
+						}
 
-					wsBuilder := iac.GetBuilder("app.terraform.io")
-					wsDirector := iac.NewDirector(wsBuilder)
-					wsDirector.Dismantle(configmap)
+						// Append Flags to ConfigMap
+						configmap.List["SERVICE"] = config.KeyValue{
+							Name:        "service",
+							Value:       service,
+							ContentType: "text/plain",
+						}
+						configmap.List["ENVIRONMENT"] = config.KeyValue{
+							Name:        "environment",
+							Value:       environment,
+							ContentType: "text/plain",
+						}
+						configmap.List["LOCATION"] = config.KeyValue{
+							Name:        "location",
+							Value:       locations.Value()[0],
+							ContentType: "text/plain",
+						}
+						configmap.List["BRANCH"] = config.KeyValue{
+							Name:        "branch",
+							Value:       branch,
+							ContentType: "text/plain",
+						}
+						configmap.List["PULL_REQUEST"] = config.KeyValue{
+							Name:        "pull-request",
+							Value:       pull_request,
+							ContentType: "text/plain",
+						}
+						if len(owner) != 0 {
+							configmap.List["OWNER"] = config.KeyValue{
+								Name:        "owner",
+								Value:       owner,
+								ContentType: "text/plain",
+							}
+						}
 
-					return nil
-				},
-				CustomHelpTemplate: get_help_text("stop"),
-				HideHelpCommand:    true,
-			},
-			{
-				Name:  "list",
-				Usage: "Returns list of previews currently hosted in the Cloud.",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:        "status",
-						Usage:       "Status of current preview resources in Azure (e.g. active, expired)",
-						Destination: &status,
-						Required:    false,
-						Action: func(ctx *cli.Context, status string) error {
-							supported := []string{
-								"active",
-								"expired",
+						// Compute Expiration
+						ttl := ttl
+						if !ctx.IsSet("ttl") {
+							default_ttl, err := iac.GetTTL(configmap)
+							if err != nil {
+								return nil, err
 							}
+							ttl = default_ttl
+						}
+						if ttl > 0 {
+							expiration := time.Now().Add(ttl)
+							if err := iac.CheckExpiration(configmap, expiration); err != nil {
+								return nil, err
+							}
+							configmap.List["EXPIRATION_DATE"] = config.KeyValue{
+								Name:        "ttl",
+								Value:       strconv.FormatInt(expiration.Unix(), 10),
+								ContentType: "text/plain",
+							}
+						}
 
-							if !slices.Contains(supported, status) {
-								return fmt.Errorf("value '%s' not supported", status)
+						if keep_on_failure {
+							configmap.List["KEEP_ON_FAILURE"] = config.KeyValue{
+								Name:        "keep-on-failure",
+								Value:       "true",
+								ContentType: "text/plain",
 							}
+						}
 
-							return nil
-						},
-					},
-				},
-				Action: func(ctx *cli.Context) error {
+						// Admins are checked against who runs the command, never --owner
+						if override_quota {
+							configmap.List["QUOTA_OVERRIDE"] = config.KeyValue{
+								Name:        "override-quota",
+								Value:       "true",
+								ContentType: "text/plain",
+							}
+							configmap.List["QUOTA_OVERRIDE_BY"] = config.KeyValue{
+								Name:        "override-quota",
+								Value:       caller,
+								ContentType: "text/plain",
+							}
+						}
 
-					var (
-						query string
-						data  map[string]interface{}
-					)
+						if ctx.IsSet("max-monthly-cost") {
+							configmap.List["MAX_MONTHLY_COST"] = config.KeyValue{
+								Name:        "max-monthly-cost",
+								Value:       strconv.FormatFloat(max_monthly_cost, 'f', -1, 64),
+								ContentType: "text/plain",
+							}
+						}
 
-					credential, err := azidentity.NewDefaultAzureCredential(nil)
-					if err != nil {
-						log.Fatal("Failed to initialize client: ", err)
+						return configmap, nil
 					}
 
-					client, err := armresourcegraph.NewClient(credential, nil)
-					if err != nil {
-						log.Fatal("Failed to initialize credential: ", err)
+					// Stack of services
+					if len(manifest) != 0 {
+						if len(service) != 0 {
+							return errors.New("--service cannot be combined with --file")
+						}
+						if len(locations.Value()) > 1 {
+							return errors.New("a single --location is supported with --file")
+						}
+						stack, err := iac.LoadStack(manifest)
+						if err != nil {
+							return err
+						}
+						if err := checkStackServices(stack); err != nil {
+							return err
+						}
+						return runError(startStack(ctx, stack, getStartConfiguration))
 					}
-
-					switch status {
-					case "active":
-						query = "Resources | where tags['ExpirationDate']!='' and tags['TerraformCloud']!='' | where unixtime_seconds_todatetime(toint(tags.ExpirationDate)) > now() | project workspace = tags.TerraformCloud"
-					case "expired":
-						query = "Resources | where tags['ExpirationDate']!='' and tags['TerraformCloud']!='' | where unixtime_seconds_todatetime(toint(tags.ExpirationDate)) < now() | project workspace = tags.TerraformCloud"
+					if len(service) == 0 {
+						return errors.New("--service or --file is required")
 					}
 
-					management_group := os.Getenv("AZURE_MANAGEMENT_GROUP")
-					res, err := client.Resources(ctx.Context, armresourcegraph.QueryRequest{
-						Query: to.Ptr(query),
-						ManagementGroups: []*string{
-							to.Ptr(management_group)},
-					}, nil)
+					configmap, err := getStartConfiguration(service)
 					if err != nil {
-						log.Fatalf("failed to finish the request: %v", err)
+						return err
 					}
 
-					if *res.TotalRecords == 0 {
-						data = map[string]interface{}{
-							"count": 0,
-							"data":  []map[string]interface{}{},
+					// Fan out to every region
+					if len(locations.Value()) > 1 {
+						args := []string{"start", "--service", service, "--environment", environment}
+						if len(branch) != 0 {
+							args = append(args, "--branch", branch)
 						}
-					} else {
-						data = map[string]interface{}{
-							"count": *res.TotalRecords,
-							"data":  []map[string]interface{}{},
+						if len(pull_request) != 0 {
+							args = append(args, "--pull-request", pull_request)
 						}
-
-						if m, ok := res.Data.([]interface{}); ok {
-							for _, r := range m {
-								items := r.(map[string]interface{})
-								data["data"] = append(data["data"].([]map[string]interface{}), items)
-							}
+						if ctx.IsSet("ttl") {
+							args = append(args, "--ttl", ttl.String())
+						}
+						if ctx.IsSet("max-monthly-cost") {
+							args = append(args, "--max-monthly-cost", strconv.FormatFloat(max_monthly_cost, 'f', -1, 64))
+						}
+						if keep_on_failure {
+							args = append(args, "--keep-on-failure")
+						}
+						if len(owner) != 0 {
+							args = append(args, "--owner", owner)
 						}
+						if override_quota {
+							args = append(args, "--override-quota")
+						}
+						return startRegions(ctx, configmap, locations.Value(), args, keep_on_failure)
 					}
 
-					jsonData, err := json.Marshal(data)
-					if err != nil {
-						log.Fatalf("Error marshaling JSON: %s", err)
+					wsBuilder := iac.GetBuilder(getBackend(configmap))
+					wsDirector := iac.NewDirector(wsBuilder)
+					_, err = wsDirector.Build(ctx.Context, configmap)
+					if err == nil {
+						err = wsDirector.Run(ctx.Context)
 					}
-
-					// Print the JSON
-					fmt.Println(string(jsonData))
-					return nil
+					notify(ctx.Context, configmap, "start", wsDirector, err)
+					return runError(err)
 				},
-				CustomHelpTemplate: get_help_text("list"),
+				CustomHelpTemplate: get_help_text("start"),
 				HideHelpCommand:    true,
 			},
-		},
+			getStopCommand(),
+			getListCommand(),
+			getDoctorCommand(),
+			getOutputsCommand(),
+			getExtendCommand(),
+			getReapCommand(),
+			getStatusCommand(),
+			getAuditCommand(),
+		}, getRunControlCommands()...),
 		CustomHelpTemplate: get_help_text("preview"),
 		HideHelpCommand:    true,
 	}
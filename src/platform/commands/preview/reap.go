@@ -0,0 +1,225 @@
+package preview_command
+
+import (
+	"fmt"
+	ci "main/interfaces/ci"
+	iac "main/interfaces/iac"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const expiredWorkspacesQuery = "Resources | where tags['ExpirationDate']!='' and tags['TerraformCloud']!='' | extend expiration = tolong(tags.ExpirationDate) | where unixtime_seconds_todatetime(expiration) < now() | summarize expiration = max(expiration) by workspace = tostring(tags.TerraformCloud)"
+
+type reapCandidate struct {
+	name       string
+	expiration time.Time
+	source     string
+}
+
+// Returns previews that expired more than grace ago, according to either the
+// workspace's expiration tag or the ExpirationDate tag of its Azure resources.
+// Workspaces outside of the preview project are never returned.
+func getReapCandidates(previews []iac.Preview, rows []map[string]interface{}, grace time.Duration) ([]reapCandidate, []string) {
+
+	var (
+		candidates = make(map[string]reapCandidate)
+		skipped    []string
+		project    = make(map[string]bool)
+	)
+
+	for _, preview := range previews {
+		project[preview.Name] = true
+		if preview.IsExpired(grace) {
+			candidates[preview.Name] = reapCandidate{
+				name:       preview.Name,
+				expiration: preview.Expiration,
+				source:     "tfc",
+			}
+		}
+	}
+
+	for _, row := range rows {
+		name, _ := row["workspace"].(string)
+		seconds, _ := row["expiration"].(float64)
+		if len(name) == 0 || seconds == 0 {
+			continue
+		}
+
+		preview := iac.Preview{Name: name, Expiration: time.Unix(int64(seconds), 0)}
+		if !preview.IsExpired(grace) {
+			continue
+		}
+		if !project[name] {
+			skipped = append(skipped, name)
+			continue
+		}
+		if _, ok := candidates[name]; !ok {
+			candidates[name] = reapCandidate{
+				name:       name,
+				expiration: preview.Expiration,
+				source:     "azure",
+			}
+		}
+	}
+
+	var list []reapCandidate
+	for _, c := range candidates {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	sort.Strings(skipped)
+
+	return list, skipped
+}
+
+// Keeps the candidates whose workspace was created by the owner.
+func filterReapCandidates(candidates []reapCandidate, previews []iac.Preview, owner string) []reapCandidate {
+
+	owned := make(map[string]bool)
+	for _, preview := range previews {
+		owned[preview.Name] = preview.OwnedBy(owner)
+	}
+
+	var filtered []reapCandidate
+	for _, c := range candidates {
+		if owned[c.name] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+func getReapCommand() *cli.Command {
+
+	var (
+		dry_run     bool
+		grace       time.Duration
+		parallelism int
+		owner       string
+		mine        bool
+	)
+
+	return &cli.Command{
+		Name:  "reap",
+		Usage: "Destroys every expired preview",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "List the previews that would be destroyed without destroying them.",
+				Destination: &dry_run,
+				Required:    false,
+			},
+			&cli.DurationFlag{
+				Name:        "grace",
+				Usage:       "How long a preview must have been expired before it is destroyed.",
+				Destination: &grace,
+				Value:       time.Hour,
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "owner",
+				Usage:       "Only destroy previews owned by this user",
+				Destination: &owner,
+				Required:    false,
+			},
+			&cli.BoolFlag{
+				Name:        "mine",
+				Usage:       "Only destroy previews owned by you: the user who triggered the CI run, or the identity signed in to Azure.",
+				Destination: &mine,
+				Required:    false,
+			},
+			&cli.IntFlag{
+				Name:        "parallelism",
+				Usage:       "Maximum number of previews destroyed at once.",
+				Destination: &parallelism,
+				Value:       4,
+				Required:    false,
+				Action: func(ctx *cli.Context, parallelism int) error {
+					if parallelism < 1 {
+						return fmt.Errorf("value '%d' not supported. Must be greater than 0", parallelism)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+
+			configmap, err := getConfiguration("reap", "")
+			if err != nil {
+				return err
+			}
+
+			owner, err := getOwnerFilter(ctx.Context, owner, mine)
+			if err != nil {
+				return err
+			}
+
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			previews, err := wsDirector.List(ctx.Context, configmap)
+			if err != nil {
+				return err
+			}
+
+			rows, err := queryResourceGraph(ctx.Context, configmap, expiredWorkspacesQuery)
+			if err != nil {
+				return err
+			}
+			candidates, skipped := getReapCandidates(previews, rows, grace)
+			if len(owner) != 0 {
+				candidates = filterReapCandidates(candidates, previews, owner)
+			}
+
+			for _, name := range skipped {
+				ci.Warning("Workspace '%s' is not in the preview project. Skipping.", name)
+			}
+
+			ci.Info("Found '%d' expired preview(s)", len(candidates))
+			if len(candidates) == 0 {
+				return nil
+			}
+
+			if dry_run {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "WORKSPACE\tEXPIRED\tSOURCE")
+				for _, c := range candidates {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", c.name, c.expiration.Format(time.RFC3339), c.source)
+				}
+				return w.Flush()
+			}
+
+			names := make([]string, len(candidates))
+			for i, c := range candidates {
+				names[i] = c.name
+			}
+			results, err := stopPreviews(names, parallelism)
+			if err != nil {
+				return err
+			}
+
+			// Report
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "WORKSPACE\tEXPIRED\tSOURCE\tRESULT")
+			for i, r := range results {
+				c := candidates[i]
+				result := "destroyed"
+				if r.err != nil {
+					result = "failed: " + r.err.Error()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.name, c.expiration.Format(time.RFC3339), c.source, result)
+			}
+			w.Flush()
+
+			if failed := countFailures(results); failed > 0 {
+				return fmt.Errorf("%d of %d preview(s) failed to be destroyed", failed, len(results))
+			}
+			return nil
+		},
+		CustomHelpTemplate: get_help_text("reap"),
+		HideHelpCommand:    true,
+	}
+}
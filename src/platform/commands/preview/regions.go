@@ -0,0 +1,211 @@
+package preview_command
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+type regionResult struct {
+	location  string
+	workspace string
+	created   bool
+	err       error
+}
+
+// Returns a copy of the configuration for a single region.
+func getRegionConfiguration(configmap *config.Configuration, location string) *config.Configuration {
+
+	regionmap := copyConfiguration(configmap)
+	regionmap.List["LOCATION"] = config.KeyValue{
+		Name:        "location",
+		Value:       location,
+		ContentType: "text/plain",
+	}
+	return regionmap
+}
+
+// Starts a region in its own process, printing its output prefixed with the
+// region. The region reports to a terminal, as logging commands would not
+// survive the prefix, and outputs are published by the parent once every
+// region finished.
+func startRegion(executable string, args []string, location string, mu *sync.Mutex) error {
+
+	args = append(append([]string{"preview"}, getOverrideArgs()...), args...)
+	args = append(args, "--location", location)
+
+	r, w := io.Pipe()
+	cmd := exec.Command(executable, args...)
+	cmd.Env = getChildEnv()
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			mu.Lock()
+			fmt.Printf("[%s] %s\n", location, line)
+			mu.Unlock()
+		}
+		io.Copy(io.Discard, r)
+	}()
+
+	err := cmd.Run()
+	w.Close()
+	<-done
+	return err
+}
+
+// Starts a preview in every region at once. Regions that succeed are rolled
+// back when another region fails, unless keep is set. Workspaces that
+// already existed are never rolled back.
+func startRegions(ctx *cli.Context, configmap *config.Configuration, locations []string, args []string, keep bool) error {
+
+	results := make([]regionResult, len(locations))
+	for i, location := range locations {
+		key := iac.GetWorkspaceKey(getRegionConfiguration(configmap, location))
+		if !key.IsDeterministic() {
+			return errors.New("previews in several regions require --branch or --pull-request")
+		}
+		name, err := key.Name(configmap.List["TFC_WORKSPACE_TEMPLATE"].Value, key.ID())
+		if err != nil {
+			return fmt.Errorf("failed to render workspace name: %w", err)
+		}
+		results[i] = regionResult{location: location, workspace: name, created: true}
+	}
+
+	// Existing workspaces are reused and never rolled back
+	wsDirector := iac.NewDirector(iac.GetBuilder(getBackend(configmap)))
+	previews, err := wsDirector.List(ctx.Context, configmap)
+	if err != nil {
+		return err
+	}
+	for _, preview := range previews {
+		for i := range results {
+			if results[i].workspace == preview.Name {
+				results[i].created = false
+			}
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	ci.Info("Starting '%d' region(s): %s", len(locations), strings.Join(locations, ", "))
+	for i := range results {
+		wg.Add(1)
+		go func(r *regionResult) {
+			defer wg.Done()
+			r.err = startRegion(executable, args, r.location, &mu)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	var failed, succeeded []regionResult
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r)
+			ci.Error("Region '%s' failed: %v", r.location, r.err)
+		} else {
+			succeeded = append(succeeded, r)
+		}
+	}
+
+	if len(failed) == 0 {
+		return publishRegionOutputs(ctx, configmap, results)
+	}
+
+	// Roll back the regions that succeeded
+	var rollback []string
+	for _, r := range succeeded {
+		if !r.created {
+			continue
+		}
+		if keep {
+			ci.Warning("Keeping workspace '%s' in region '%s'", r.workspace, r.location)
+			continue
+		}
+		rollback = append(rollback, r.workspace)
+	}
+	if len(rollback) != 0 {
+		ci.Warning("Rolling back '%d' region(s)", len(rollback))
+		stopped, err := stopPreviews(rollback, len(rollback))
+		if err != nil {
+			return err
+		}
+		for _, r := range stopped {
+			if r.err != nil {
+				ci.Error("Failed to roll back workspace '%s': %v", r.name, r.err)
+			}
+		}
+	}
+
+	return fmt.Errorf("%d of %d region(s) failed", len(failed), len(results))
+}
+
+// Publishes the outputs of every region, keyed by region. Step outputs are
+// named '<location>_<output>'.
+func publishRegionOutputs(ctx *cli.Context, configmap *config.Configuration, results []regionResult) error {
+
+	var (
+		outputs = make(map[string][]iac.Output)
+		urls    []string
+	)
+
+	for _, r := range results {
+		regionmap := getRegionConfiguration(configmap, r.location)
+		regionmap.List["TFC_WORKSPACE"] = config.KeyValue{
+			Name:        "workspace",
+			Value:       r.workspace,
+			ContentType: "text/plain",
+		}
+
+		wsDirector := iac.NewDirector(iac.GetBuilder(getBackend(regionmap)))
+		list, err := wsDirector.Outputs(ctx.Context, regionmap)
+		if err != nil {
+			return fmt.Errorf("failed to read outputs of region '%s': %w", r.location, err)
+		}
+
+		for _, url := range iac.PublishOutputs(list, r.location+"_") {
+			urls = append(urls, r.location+": "+url)
+		}
+		for _, output := range list {
+			outputs[r.location] = append(outputs[r.location], output.Masked())
+		}
+		ci.Summary(iac.OutputSummary(r.workspace, list))
+	}
+
+	ci.Group("Terraform Output")
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(outputs); err != nil {
+		return err
+	}
+	ci.EndGroup()
+
+	for _, url := range urls {
+		ci.Section("URL: %s", url)
+	}
+	return nil
+}
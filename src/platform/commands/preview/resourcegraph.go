@@ -0,0 +1,198 @@
+package preview_command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resourcegraph/armresourcegraph"
+)
+
+const (
+	// Largest page the Resource Graph API returns.
+	resourceGraphPageSize = 1000
+
+	// Times a throttled query is retried before giving up.
+	resourceGraphRetries = 5
+)
+
+// Returns the subscriptions and management groups Resource Graph queries are
+// scoped to, from AZURE_SUBSCRIPTIONS and AZURE_MANAGEMENT_GROUPS. Without
+// either, the AZURE_MANAGEMENT_GROUP environment variable is used and, when
+// it is not set either, every subscription the identity can read.
+func getResourceGraphScope(configmap *config.Configuration) ([]*string, []*string, error) {
+
+	split := func(value string) []*string {
+		var list []*string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) != 0 {
+				list = append(list, to.Ptr(item))
+			}
+		}
+		return list
+	}
+
+	subscriptions := split(configmap.List["AZURE_SUBSCRIPTIONS"].Value)
+	management_groups := split(configmap.List["AZURE_MANAGEMENT_GROUPS"].Value)
+	if len(subscriptions) != 0 && len(management_groups) != 0 {
+		return nil, nil, errors.New("resource graph queries are scoped to either subscriptions or management groups, not both")
+	}
+	if len(subscriptions) == 0 && len(management_groups) == 0 {
+		management_groups = split(os.Getenv("AZURE_MANAGEMENT_GROUP"))
+	}
+
+	return subscriptions, management_groups, nil
+}
+
+// Returns every row of a Resource Graph query, following SkipToken through
+// each page.
+func queryResourceGraph(ctx context.Context, configmap *config.Configuration, query string) ([]map[string]interface{}, error) {
+
+	subscriptions, management_groups, err := getResourceGraphScope(configmap)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize credential: %w", err)
+	}
+
+	// Throttled queries are retried by queryResourceGraphPage, so they can
+	// be reported.
+	client, err := armresourcegraph.NewClient(credential, &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Retry: policy.RetryOptions{
+				StatusCodes: []int{
+					http.StatusRequestTimeout,
+					http.StatusInternalServerError,
+					http.StatusBadGateway,
+					http.StatusServiceUnavailable,
+					http.StatusGatewayTimeout,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize client: %w", err)
+	}
+
+	request := armresourcegraph.QueryRequest{
+		Query:            to.Ptr(query),
+		Subscriptions:    subscriptions,
+		ManagementGroups: management_groups,
+		Options: &armresourcegraph.QueryRequestOptions{
+			ResultFormat: to.Ptr(armresourcegraph.ResultFormatObjectArray),
+			Top:          to.Ptr(int32(resourceGraphPageSize)),
+		},
+	}
+
+	var rows []map[string]interface{}
+	for {
+		res, err := queryResourceGraphPage(ctx, client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		if m, ok := res.Data.([]interface{}); ok {
+			for _, r := range m {
+				if row, ok := r.(map[string]interface{}); ok {
+					rows = append(rows, row)
+				}
+			}
+		}
+
+		if res.SkipToken == nil || len(*res.SkipToken) == 0 {
+			if res.ResultTruncated != nil && *res.ResultTruncated == armresourcegraph.ResultTruncatedTrue {
+				ci.Warning("Resource Graph truncated the results at '%d' row(s)", len(rows))
+			}
+			break
+		}
+		request.Options.SkipToken = res.SkipToken
+	}
+
+	return rows, nil
+}
+
+// Returns a page of a Resource Graph query. Throttled requests are retried
+// once the user quota resets, and a page that spends the last of the quota
+// waits for it before the next page is requested.
+func queryResourceGraphPage(ctx context.Context, client *armresourcegraph.Client, request armresourcegraph.QueryRequest) (armresourcegraph.ClientResourcesResponse, error) {
+
+	for attempt := 0; ; attempt++ {
+
+		var raw *http.Response
+		res, err := client.Resources(runtime.WithCaptureResponse(ctx, &raw), request, nil)
+		if err == nil {
+			if raw != nil && raw.Header.Get("x-ms-user-quota-remaining") == "0" {
+				delay := getThrottleDelay(raw.Header, attempt)
+				ci.Warning("Resource Graph quota exhausted. Waiting %s", delay)
+				if err := sleep(ctx, delay); err != nil {
+					return res, err
+				}
+			}
+			return res, nil
+		}
+
+		var res_err *azcore.ResponseError
+		if !errors.As(err, &res_err) || res_err.StatusCode != http.StatusTooManyRequests {
+			return res, fmt.Errorf("failed to query resource graph: %w", err)
+		}
+		if attempt == resourceGraphRetries {
+			return res, fmt.Errorf("resource graph throttled the query %d times: %w", attempt+1, err)
+		}
+
+		var header http.Header
+		if res_err.RawResponse != nil {
+			header = res_err.RawResponse.Header
+		}
+		delay := getThrottleDelay(header, attempt)
+		ci.Warning("Resource Graph throttled the query. Retrying in %s (%d/%d)", delay, attempt+1, resourceGraphRetries)
+		if err := sleep(ctx, delay); err != nil {
+			return res, err
+		}
+	}
+}
+
+// Returns how long to wait for the Resource Graph quota to reset, using its
+// hh:mm:ss reset header, then Retry-After, then an exponential backoff.
+func getThrottleDelay(header http.Header, attempt int) time.Duration {
+
+	if value := header.Get("x-ms-user-quota-resets-after"); len(value) != 0 {
+		if t, err := time.Parse("15:04:05", value); err == nil {
+			delay := t.Sub(time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC))
+			return max(delay, time.Second)
+		}
+	}
+	if value := header.Get("Retry-After"); len(value) != 0 {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return max(time.Duration(seconds)*time.Second, time.Second)
+		}
+	}
+	return time.Duration(1<<attempt) * time.Second
+}
+
+// Waits for the delay, unless the context is done first.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package preview_command
+
+import (
+	"context"
+	"fmt"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Returns a subcommand that targets a workspace, or the workspace of a run,
+// and applies an action to it.
+func getRunControlCommand(name string, usage string, action func(context.Context, *iac.IacDirector, *config.Configuration, string) error) *cli.Command {
+
+	var (
+		workspace string
+		run       string
+		reason    string
+	)
+
+	return &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "workspace",
+				Usage:       "Terraform Workspace. The latest run is used when a run is required.",
+				Destination: &workspace,
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "run",
+				Usage:       "Terraform Cloud Run ID (e.g. run-CZcmD7eagjhyX0vN)",
+				Destination: &run,
+				Required:    false,
+				Action: func(ctx *cli.Context, run string) error {
+					if !strings.HasPrefix(run, "run-") {
+						return fmt.Errorf("value '%s' not supported. Must be a run ID", run)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:        "reason",
+				Usage:       "Optional reason recorded in Terraform Cloud",
+				Destination: &reason,
+				Required:    false,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+
+			if (len(workspace) == 0) == (len(run) == 0) {
+				return fmt.Errorf("exactly one of --workspace or --run is required")
+			}
+
+			configmap, err := getConfiguration(name, "")
+			if err != nil {
+				return err
+			}
+
+			// Append Flags to ConfigMap
+			configmap.List["TFC_WORKSPACE"] = config.KeyValue{
+				Name:        "workspace",
+				Value:       workspace,
+				ContentType: "text/plain",
+			}
+			configmap.List["TFC_RUN"] = config.KeyValue{
+				Name:        "run",
+				Value:       run,
+				ContentType: "text/plain",
+			}
+
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			return action(ctx.Context, wsDirector, configmap, reason)
+		},
+		CustomHelpTemplate: get_help_text(name),
+		HideHelpCommand:    true,
+	}
+}
+
+func getRunControlCommands() []*cli.Command {
+	return []*cli.Command{
+		getRunControlCommand("cancel", "Cancels the in-flight run of a preview", func(ctx context.Context, d *iac.IacDirector, c *config.Configuration, reason string) error {
+			return d.Cancel(ctx, c, reason)
+		}),
+		getRunControlCommand("discard", "Discards a run of a preview that is waiting for confirmation", func(ctx context.Context, d *iac.IacDirector, c *config.Configuration, reason string) error {
+			return d.Discard(ctx, c, reason)
+		}),
+		getRunControlCommand("lock", "Locks the workspace of a preview to prevent new runs", func(ctx context.Context, d *iac.IacDirector, c *config.Configuration, reason string) error {
+			return d.Lock(ctx, c, reason)
+		}),
+		getRunControlCommand("unlock", "Unlocks the workspace of a preview", func(ctx context.Context, d *iac.IacDirector, c *config.Configuration, reason string) error {
+			return d.Unlock(ctx, c)
+		}),
+	}
+}
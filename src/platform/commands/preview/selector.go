@@ -0,0 +1,88 @@
+package preview_command
+
+import (
+	config "main/interfaces/configuration"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Identifies previews by exact workspace name or ID, falling back to the
+// service, branch, owner and location tags of their workspace.
+type workspaceSelector struct {
+	workspace string
+	service   string
+	branch    string
+	owner     string
+	location  string
+	tags      cli.StringSlice
+}
+
+// Returns the selector flags. Commands that already take --service pass
+// false to leave it out.
+func getSelectorFlags(selector *workspaceSelector, service bool) []cli.Flag {
+
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:        "workspace",
+			Usage:       "Terraform Workspace name or ID",
+			Destination: &selector.workspace,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "branch",
+			Usage:       "Select the preview built from this branch",
+			Destination: &selector.branch,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "owner",
+			Usage:       "Select the preview owned by this user",
+			Destination: &selector.owner,
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "location",
+			Usage:       "Select the preview built in this Azure Region",
+			Destination: &selector.location,
+			Required:    false,
+		},
+		&cli.StringSliceFlag{
+			Name:        "tag",
+			Usage:       "Select the preview whose workspace has this tag. Repeat to require several tags.",
+			Destination: &selector.tags,
+			Required:    false,
+		},
+	}
+
+	if service {
+		flags = append(flags, &cli.StringFlag{
+			Name:        "service",
+			Usage:       "Select the preview of this service",
+			Destination: &selector.service,
+			Required:    false,
+		})
+	}
+
+	return flags
+}
+
+// Appends the selector to the ConfigMap.
+func setSelector(configmap *config.Configuration, selector *workspaceSelector) {
+
+	values := map[string]config.KeyValue{
+		"TFC_WORKSPACE": {Name: "workspace", Value: selector.workspace},
+		"BRANCH":        {Name: "branch", Value: selector.branch},
+		"OWNER":         {Name: "owner", Value: selector.owner},
+		"LOCATION":      {Name: "location", Value: selector.location},
+		"TAGS":          {Name: "tag", Value: strings.Join(selector.tags.Value(), ",")},
+	}
+	if len(selector.service) != 0 {
+		values["SERVICE"] = config.KeyValue{Name: "service", Value: selector.service}
+	}
+
+	for key, value := range values {
+		value.ContentType = "text/plain"
+		configmap.List[key] = value
+	}
+}
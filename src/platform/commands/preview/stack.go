@@ -0,0 +1,147 @@
+package preview_command
+
+import (
+	"errors"
+	"fmt"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Returns the names of the services in order.
+func getServiceNames(services []iac.StackService) []string {
+	names := make([]string, len(services))
+	for i, service := range services {
+		names[i] = service.Name
+	}
+	return names
+}
+
+// Checks every service of a stack is one --service accepts.
+func checkStackServices(stack *iac.Stack) error {
+	for _, service := range stack.Services {
+		if !slices.Contains(supportedServices, service.Name) {
+			return fmt.Errorf("service '%s' of the manifest not supported. Allowed Value: %v", service.Name, supportedServices)
+		}
+	}
+	return nil
+}
+
+// Starts every service of a stack after the services it depends on, wiring
+// their outputs into its variables. A service that fails stops the stack;
+// the services already started are kept, so starting the stack again
+// resumes where it failed.
+func startStack(ctx *cli.Context, stack *iac.Stack, getStartConfiguration func(string) (*config.Configuration, error)) error {
+
+	order, err := stack.Order()
+	if err != nil {
+		return err
+	}
+	ci.Info("Starting stack: %s", strings.Join(getServiceNames(order), " -> "))
+
+	outputs := make(map[string][]iac.Output)
+	for _, service := range order {
+
+		ci.Section("Service '%s'", service.Name)
+
+		configmap, err := getStartConfiguration(service.Name)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+		inputs, err := iac.StackInputs(service, outputs)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+		keys := make([]string, 0, len(inputs))
+		for key, value := range inputs {
+			configmap.List[key] = value
+			keys = append(keys, key)
+		}
+
+		// Inputs only reach the workspace through a variable mapping
+		unmapped, err := iac.UnmappedKeys(configmap, keys)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+		if len(unmapped) != 0 {
+			return fmt.Errorf("service '%s': no TFC_VARIABLES mapping for inputs '%s'. Map 'tfvar:*' and 'tfvar-hcl:*' to Terraform variables", service.Name, strings.Join(unmapped, ", "))
+		}
+
+		wsBuilder := iac.GetBuilder(getBackend(configmap))
+		wsDirector := iac.NewDirector(wsBuilder)
+		_, err = wsDirector.Build(ctx.Context, configmap)
+		if err == nil {
+			err = wsDirector.Run(ctx.Context)
+		}
+		notify(ctx.Context, configmap, "start", wsDirector, err)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+		outputs[service.Name], err = wsDirector.RunOutputs(ctx.Context)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Stops every service of a stack before the services it depends on. Services
+// without a matching preview are skipped.
+func stopStack(ctx *cli.Context, stack *iac.Stack, getStopConfiguration func(string) (*config.Configuration, error)) error {
+
+	configmap, err := getStopConfiguration("")
+	if err != nil {
+		return err
+	}
+
+	if len(iac.SelectorTags(configmap)) == 0 {
+		return errors.New("--file requires at least one of --branch, --owner, --location or --tag")
+	}
+
+	order, err := stack.Order()
+	if err != nil {
+		return err
+	}
+
+	wsBuilder := iac.GetBuilder(getBackend(configmap))
+	wsDirector := iac.NewDirector(wsBuilder)
+	previews, err := wsDirector.List(ctx.Context, configmap)
+	if err != nil {
+		return err
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		service := order[i]
+
+		servicemap, err := getStopConfiguration(service.Name)
+		if err != nil {
+			return err
+		}
+		servicemap.List["SERVICE"] = config.KeyValue{
+			Name:        "service",
+			Value:       service.Name,
+			ContentType: "text/plain",
+		}
+
+		if len(iac.SelectPreviews(previews, servicemap)) == 0 {
+			ci.Info("No preview of service '%s'. Skipping.", service.Name)
+			continue
+		}
+
+		ci.Section("Service '%s'", service.Name)
+		wsBuilder := iac.GetBuilder(getBackend(servicemap))
+		wsDirector := iac.NewDirector(wsBuilder)
+		err = wsDirector.Dismantle(ctx.Context, servicemap)
+		notify(ctx.Context, servicemap, "stop", wsDirector, err)
+		if err != nil {
+			return fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+	}
+
+	return nil
+}
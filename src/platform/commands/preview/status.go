@@ -0,0 +1,113 @@
+package preview_command
+
+import (
+	"encoding/json"
+	"fmt"
+	iac "main/interfaces/iac"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func printStatus(status iac.Status) error {
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Workspace:\t%s\n", status.Name)
+	fmt.Fprintf(w, "ID:\t%s\n", status.ID)
+	fmt.Fprintf(w, "URL:\t%s\n", status.URL)
+	if len(status.Branch) != 0 {
+		fmt.Fprintf(w, "Branch:\t%s\n", status.Branch)
+	}
+	if len(status.Commit) != 0 {
+		fmt.Fprintf(w, "Commit:\t%s\n", status.Commit)
+	}
+	if len(status.Owner) != 0 {
+		fmt.Fprintf(w, "Owner:\t%s\n", status.Owner)
+	}
+	if status.Expiration != nil {
+		fmt.Fprintf(w, "Expiration:\t%s (%s remaining)\n", status.Expiration.Format(time.RFC3339), time.Until(*status.Expiration).Round(time.Minute))
+	}
+	fmt.Fprintf(w, "Locked:\t%t\n", status.Locked)
+	fmt.Fprintf(w, "Resources:\t%d\n", status.ResourceCount)
+	if status.Run != nil {
+		fmt.Fprintf(w, "Latest Run:\t%s (%s, %s)\n", status.Run.ID, status.Run.Status, status.Run.Duration)
+		fmt.Fprintf(w, "Run URL:\t%s\n", status.Run.URL)
+	}
+	if len(status.Outputs) != 0 {
+		fmt.Fprintln(w, "Outputs:\t")
+		for _, output := range status.Outputs {
+			fmt.Fprintf(w, "  %s\t%s\n", output.Name, output.String())
+		}
+	}
+
+	return w.Flush()
+}
+
+func getStatusCommand() *cli.Command {
+
+	var (
+		selector workspaceSelector
+		output   string
+	)
+
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Shows the full state of a single preview",
+		Flags: append(getSelectorFlags(&selector, true),
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       "Output format.  Allowed values: json, text.  Default: text.",
+				Destination: &output,
+				Value:       "text",
+				Required:    false,
+				Action: func(ctx *cli.Context, output string) error {
+
+					supported := []string{
+						"json",
+						"text",
+					}
+
+					if !slices.Contains(supported, output) {
+						return fmt.Errorf("value '%s' not supported. Allowed Value: %v", output, supported)
+					}
+
+					return nil
+				},
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+
+			configmap, err := getConfiguration("status", "")
+			if err != nil {
+				return err
+			}
+
+			// Append Flags to ConfigMap
+			setSelector(configmap, &selector)
+
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			status, err := wsDirector.Status(ctx.Context, configmap)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				val, err := json.MarshalIndent(status, "", "    ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON output: %w", err)
+				}
+				fmt.Println(string(val))
+				return nil
+			}
+
+			return printStatus(status)
+		},
+		CustomHelpTemplate: get_help_text("status"),
+		HideHelpCommand:    true,
+	}
+}
@@ -0,0 +1,352 @@
+package preview_command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	iac "main/interfaces/iac"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+type stopResult struct {
+	name   string
+	output string
+	err    error
+}
+
+// Collects the output of a child process, whose stdout and stderr are
+// written from separate goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Returns the last error a child process reported on stderr, or its last
+// line when it reported none.
+func lastErrorLine(stderr string) string {
+	var last string
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if message, ok := strings.CutPrefix(line, "Error: "); ok {
+			return message
+		}
+		if len(last) == 0 {
+			last = line
+		}
+	}
+	return last
+}
+
+// Each preview is stopped in its own process so a failure only affects
+// that workspace. Children report errors to stderr, and the last one is
+// kept with the result.
+func stopPreview(executable string, name string) stopResult {
+
+	args := append([]string{"preview"}, getOverrideArgs()...)
+	args = append(args, "stop", "--workspace", name)
+
+	var (
+		output syncBuffer
+		stderr bytes.Buffer
+	)
+	cmd := exec.Command(executable, args...)
+	cmd.Env = getChildEnv()
+	cmd.Stdout = &output
+	cmd.Stderr = io.MultiWriter(&output, &stderr)
+	err := cmd.Run()
+
+	if err != nil {
+		if line := lastErrorLine(stderr.String()); len(line) != 0 {
+			err = fmt.Errorf("%s (%w)", line, err)
+		}
+	}
+
+	return stopResult{
+		name:   name,
+		output: output.String(),
+		err:    err,
+	}
+}
+
+// Stops the named previews, at most parallelism at once. Results are
+// returned in the order of names and the output of failures is printed.
+func stopPreviews(names []string, parallelism int) ([]stopResult, error) {
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, parallelism)
+		results = make([]stopResult, len(names))
+	)
+
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ci.Info("Destroying '%s'", name)
+			results[i] = stopPreview(executable, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.err != nil {
+			ci.Group("%s", r.name)
+			fmt.Println(strings.TrimSpace(r.output))
+			ci.EndGroup()
+		}
+	}
+
+	return results, nil
+}
+
+// Returns the number of failed results.
+func countFailures(results []stopResult) int {
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Stops every preview in the preview project matching the selector, once
+// the list has been confirmed.
+func stopAll(ctx *cli.Context, configmap *config.Configuration, yes bool, parallelism int) error {
+
+	if len(iac.SelectorTags(configmap)) == 0 {
+		return errors.New("--all requires at least one of --service, --branch, --owner, --location or --tag")
+	}
+
+	wsBuilder := iac.GetBuilder(getBackend(configmap))
+	wsDirector := iac.NewDirector(wsBuilder)
+	previews, err := wsDirector.List(ctx.Context, configmap)
+	if err != nil {
+		return err
+	}
+
+	selected := iac.SelectPreviews(previews, configmap)
+	ci.Info("Found '%d' matching preview(s)", len(selected))
+	if len(selected) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tEXPIRES\tTAGS")
+	for _, p := range selected {
+		expires := "never"
+		if !p.Expiration.IsZero() {
+			expires = p.Expiration.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, expires, strings.Join(p.Tags, ","))
+	}
+	w.Flush()
+
+	if !yes {
+		confirmed, err := iac.Confirm(fmt.Sprintf("Destroy '%d' preview(s)?", len(selected)))
+		if err != nil {
+			return fmt.Errorf("%w. Use --yes to destroy without confirming", err)
+		}
+		if !confirmed {
+			ci.Info("No previews were destroyed")
+			return nil
+		}
+	}
+
+	names := make([]string, len(selected))
+	for i, p := range selected {
+		names[i] = p.Name
+	}
+	results, err := stopPreviews(names, parallelism)
+	if err != nil {
+		return err
+	}
+
+	// Report
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tRESULT")
+	for _, r := range results {
+		result := "destroyed"
+		if r.err != nil {
+			result = "failed: " + r.err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\n", r.name, result)
+	}
+	w.Flush()
+
+	if failed := countFailures(results); failed > 0 {
+		return fmt.Errorf("%d of %d preview(s) failed to be destroyed", failed, len(results))
+	}
+	return nil
+}
+
+func getStopCommand() *cli.Command {
+
+	var (
+		selector    workspaceSelector
+		all         bool
+		yes         bool
+		parallelism int
+		manifest    string
+		mine        bool
+	)
+
+	return &cli.Command{
+		Name:  "stop",
+		Usage: "Create and approve a generated plan in Terraform Cloud to tear down infrastructure",
+		Flags: append(getSelectorFlags(&selector, true),
+			&cli.BoolFlag{
+				Name:        "all",
+				Usage:       "Stop every preview matching the selectors instead of a single one.",
+				Destination: &all,
+				Required:    false,
+			},
+			&cli.BoolFlag{
+				Name:        "mine",
+				Usage:       "Select previews owned by you: the user who triggered the CI run, or the identity signed in to Azure.",
+				Destination: &mine,
+				Required:    false,
+			},
+			&cli.BoolFlag{
+				Name:        "yes",
+				Usage:       "Stop the previews matched by --all without asking for confirmation.",
+				Destination: &yes,
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:        "file",
+				Aliases:     []string{"f"},
+				Usage:       "Preview manifest whose services are stopped in reverse order of their dependencies.",
+				Destination: &manifest,
+				Required:    false,
+			},
+			&cli.IntFlag{
+				Name:        "parallelism",
+				Usage:       "Maximum number of previews destroyed at once when using --all.",
+				Destination: &parallelism,
+				Value:       4,
+				Required:    false,
+				Action: func(ctx *cli.Context, parallelism int) error {
+					if parallelism < 1 {
+						return fmt.Errorf("value '%d' not supported. Must be greater than 0", parallelism)
+					}
+					return nil
+				},
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+
+			owner, err := getOwnerFilter(ctx.Context, selector.owner, mine)
+			if err != nil {
+				return err
+			}
+			selector.owner = owner
+
+			// Returns the configuration of a service, with the selector applied
+			getStopConfiguration := func(service string) (*config.Configuration, error) {
+				configmap, err := getConfiguration("stop", service)
+				if err != nil {
+					return nil, err
+				}
+				setSelector(configmap, &selector)
+				return configmap, nil
+			}
+
+			if len(manifest) != 0 {
+				if len(selector.workspace) != 0 || len(selector.service) != 0 || all {
+					return errors.New("--workspace, --service and --all cannot be combined with --file")
+				}
+				stack, err := iac.LoadStack(manifest)
+				if err != nil {
+					return err
+				}
+				if err := checkStackServices(stack); err != nil {
+					return err
+				}
+				return runError(stopStack(ctx, stack, getStopConfiguration))
+			}
+
+			if all {
+				if len(selector.workspace) != 0 {
+					return errors.New("--workspace cannot be combined with --all")
+				}
+				configmap, err := getStopConfiguration(selector.service)
+				if err != nil {
+					return err
+				}
+				return stopAll(ctx, configmap, yes, parallelism)
+			}
+
+			// The service is read from the workspace when it is not given, as
+			// its labels hold the NOTIFY_WEBHOOK. stop --all, reap and rollbacks
+			// stop each preview by workspace name.
+			service := selector.service
+			if len(service) == 0 {
+				configmap, err := getStopConfiguration("")
+				if err != nil {
+					return err
+				}
+				wsDirector := iac.NewDirector(iac.GetBuilder(getBackend(configmap)))
+				if err := wsDirector.Find(ctx.Context, configmap); err != nil {
+					notify(ctx.Context, configmap, "stop", wsDirector, err)
+					return runError(err)
+				}
+				found, err := wsDirector.WorkspaceService()
+				if err != nil {
+					ci.Warning("Failed to read the service of workspace '%s': %v", wsDirector.WorkspaceName(), err)
+				}
+				service = found
+				selector = workspaceSelector{workspace: wsDirector.WorkspaceName()}
+			}
+
+			configmap, err := getStopConfiguration(service)
+			if err != nil {
+				return err
+			}
+			if len(service) != 0 {
+				configmap.List["SERVICE"] = config.KeyValue{
+					Name:        "service",
+					Value:       service,
+					ContentType: "text/plain",
+				}
+			}
+			wsBuilder := iac.GetBuilder(getBackend(configmap))
+			wsDirector := iac.NewDirector(wsBuilder)
+			err = wsDirector.Dismantle(ctx.Context, configmap)
+			notify(ctx.Context, configmap, "stop", wsDirector, err)
+			return runError(err)
+		},
+		CustomHelpTemplate: get_help_text("stop"),
+		HideHelpCommand:    true,
+	}
+}
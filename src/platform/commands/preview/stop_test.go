@@ -0,0 +1,23 @@
+package preview_command
+
+import "testing"
+
+func TestLastErrorLine(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"last error", "Warning: Rolling back\nError: Run had errors!\nError: run 'run-1' errored\n", "run 'run-1' errored"},
+		{"joined error", "Error: run 'run-1' errored\nfailed to read error log: 404\n", "run 'run-1' errored"},
+		{"no error prefix", "Lookup 'api' workspace\npanic: boom\n", "panic: boom"},
+	}
+
+	for _, c := range cases {
+		if got := lastErrorLine(c.stderr); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
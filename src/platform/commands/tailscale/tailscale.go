@@ -4,7 +4,7 @@ import (
 	"embed"
 	_ "embed"
 	"fmt"
-	"log"
+	ci "main/interfaces/ci"
 	"os"
 	"os/exec"
 	"runtime"
@@ -86,17 +86,19 @@ func GetCommand() *cli.Command {
 				},
 				Action: func(ctx *cli.Context) error {
 
-					fmt.Println("##[group] Download Tailscale")
+					ci.Group("Download Tailscale")
 					if runtime.GOOS == "linux" {
 
 						connect, err := scripts.ReadFile("bash/connect.sh")
 						if err != nil {
-							log.Fatal(err)
+							ci.EndGroup()
+							return err
 						}
 
 						file, err := os.CreateTemp("/tmp", "platform.*.sh")
 						if err != nil {
-							log.Fatal(err)
+							ci.EndGroup()
+							return err
 						}
 						file.Write(connect)
 
@@ -108,7 +110,7 @@ func GetCommand() *cli.Command {
 						).Output()
 
 						if err != nil {
-							fmt.Printf("error %s\n", err)
+							ci.Error("%v", err)
 						}
 
 						output := string(cmd)
@@ -116,7 +118,7 @@ func GetCommand() *cli.Command {
 						defer os.Remove(file.Name())
 
 					}
-					fmt.Println("##[endgroup]")
+					ci.EndGroup()
 					return nil
 				},
 				CustomHelpTemplate: get_help_text("install"),
@@ -0,0 +1,84 @@
+package ci
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Azure Pipelines logging commands.
+// https://learn.microsoft.com/azure/devops/pipelines/scripts/logging-commands
+type AzureDevOpsReporter struct {
+	out     io.Writer
+	tempdir string
+}
+
+func NewAzureDevOpsReporter(getenv func(string) string) *AzureDevOpsReporter {
+	return &AzureDevOpsReporter{
+		tempdir: getenv("AGENT_TEMPDIRECTORY"),
+	}
+}
+
+func (r *AzureDevOpsReporter) writer() io.Writer {
+	if r.out != nil {
+		return r.out
+	}
+	return os.Stdout
+}
+
+// Values of logging commands cannot span lines.
+var azureDevOpsEscaper = strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A")
+
+func (r *AzureDevOpsReporter) Info(message string) {
+	fmt.Fprintf(r.writer(), "##[info] %s\n", message)
+}
+
+func (r *AzureDevOpsReporter) Warning(message string) {
+	fmt.Fprintf(r.writer(), "##[warning] %s\n", message)
+}
+
+func (r *AzureDevOpsReporter) Error(message string) {
+	fmt.Fprintf(r.writer(), "##[error] %s\n", message)
+}
+
+func (r *AzureDevOpsReporter) Section(message string) {
+	fmt.Fprintf(r.writer(), "##[section] %s\n", message)
+}
+
+func (r *AzureDevOpsReporter) Group(name string) {
+	fmt.Fprintf(r.writer(), "##[group]%s\n", name)
+}
+
+func (r *AzureDevOpsReporter) EndGroup() {
+	fmt.Fprintln(r.writer(), "##[endgroup]")
+}
+
+// Sets an output variable, referenced by later jobs as
+// dependencies.<job>.outputs['<step>.<name>'].
+func (r *AzureDevOpsReporter) SetOutput(name string, value string, secret bool) error {
+	properties := "variable=" + name + ";isOutput=true"
+	if secret {
+		properties += ";issecret=true"
+	}
+	fmt.Fprintf(r.writer(), "##vso[task.setvariable %s]%s\n", properties, azureDevOpsEscaper.Replace(value))
+	return nil
+}
+
+// Uploads the Markdown to the Extensions tab of the run. The file is written
+// to the agent's temporary directory, so nothing is uploaded off an agent.
+func (r *AzureDevOpsReporter) Summary(markdown string) error {
+	if len(r.tempdir) == 0 {
+		return nil
+	}
+	f, err := os.CreateTemp(r.tempdir, "platform-summary-*.md")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(markdown); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.writer(), "##vso[task.uploadsummary]%s\n", f.Name())
+	return nil
+}
@@ -0,0 +1,111 @@
+package ci
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// GitHub Actions workflow commands.
+// https://docs.github.com/actions/using-workflows/workflow-commands-for-github-actions
+type GitHubReporter struct {
+	out     io.Writer
+	output  string
+	summary string
+}
+
+func NewGitHubReporter(getenv func(string) string) *GitHubReporter {
+	return &GitHubReporter{
+		output:  getenv("GITHUB_OUTPUT"),
+		summary: getenv("GITHUB_STEP_SUMMARY"),
+	}
+}
+
+func (r *GitHubReporter) writer() io.Writer {
+	if r.out != nil {
+		return r.out
+	}
+	return os.Stdout
+}
+
+// Messages of workflow commands cannot span lines.
+var gitHubEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+func (r *GitHubReporter) Info(message string) {
+	fmt.Fprintln(r.writer(), message)
+}
+
+func (r *GitHubReporter) Warning(message string) {
+	fmt.Fprintf(r.writer(), "::warning::%s\n", gitHubEscaper.Replace(message))
+}
+
+func (r *GitHubReporter) Error(message string) {
+	fmt.Fprintf(r.writer(), "::error::%s\n", gitHubEscaper.Replace(message))
+}
+
+func (r *GitHubReporter) Section(message string) {
+	fmt.Fprintln(r.writer(), message)
+}
+
+func (r *GitHubReporter) Group(name string) {
+	fmt.Fprintf(r.writer(), "::group::%s\n", gitHubEscaper.Replace(name))
+}
+
+func (r *GitHubReporter) EndGroup() {
+	fmt.Fprintln(r.writer(), "::endgroup::")
+}
+
+// Appends the output to $GITHUB_OUTPUT, referenced by later steps as
+// steps.<id>.outputs.<name>. Secrets are masked in the log first.
+func (r *GitHubReporter) SetOutput(name string, value string, secret bool) error {
+
+	if len(r.output) == 0 {
+		return errors.New("GITHUB_OUTPUT is not set")
+	}
+	if secret {
+		for _, line := range strings.Split(value, "\n") {
+			if len(line) != 0 {
+				fmt.Fprintf(r.writer(), "::add-mask::%s\n", gitHubEscaper.Replace(line))
+			}
+		}
+	}
+
+	delimiter, err := newDelimiter()
+	if err != nil {
+		return err
+	}
+	return appendFile(r.output, fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter))
+}
+
+// Appends the Markdown to $GITHUB_STEP_SUMMARY.
+func (r *GitHubReporter) Summary(markdown string) error {
+	if len(r.summary) == 0 {
+		return errors.New("GITHUB_STEP_SUMMARY is not set")
+	}
+	return appendFile(r.summary, markdown+"\n")
+}
+
+// Returns a delimiter for multiline values that cannot appear in them.
+func newDelimiter() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b), nil
+}
+
+func appendFile(path string, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,107 @@
+package ci
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DotenvVariable names the file GitLab outputs are written to, to be
+// declared as an artifacts:reports:dotenv report of the job.
+const DotenvVariable = "PLATFORM_DOTENV"
+
+const defaultDotenv = "platform.env"
+
+var dotenvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GitLab CI collapsible sections and dotenv reports.
+// https://docs.gitlab.com/ee/ci/jobs/#custom-collapsible-sections
+type GitLabReporter struct {
+	out    io.Writer
+	dotenv string
+
+	mu       sync.Mutex
+	sections []string
+	count    int
+}
+
+func NewGitLabReporter(getenv func(string) string) *GitLabReporter {
+	dotenv := getenv(DotenvVariable)
+	if len(dotenv) == 0 {
+		dotenv = defaultDotenv
+	}
+	return &GitLabReporter{
+		dotenv: dotenv,
+	}
+}
+
+func (r *GitLabReporter) writer() io.Writer {
+	if r.out != nil {
+		return r.out
+	}
+	return os.Stdout
+}
+
+func (r *GitLabReporter) Info(message string) {
+	fmt.Fprintln(r.writer(), message)
+}
+
+func (r *GitLabReporter) Warning(message string) {
+	fmt.Fprintf(r.writer(), "\x1b[0;33mWARNING: %s\x1b[0m\n", message)
+}
+
+func (r *GitLabReporter) Error(message string) {
+	fmt.Fprintf(r.writer(), "\x1b[0;31mERROR: %s\x1b[0m\n", message)
+}
+
+func (r *GitLabReporter) Section(message string) {
+	fmt.Fprintf(r.writer(), "\x1b[1m%s\x1b[0m\n", message)
+}
+
+func (r *GitLabReporter) Group(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	id := fmt.Sprintf("platform_%d", r.count)
+	r.sections = append(r.sections, id)
+	fmt.Fprintf(r.writer(), "\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s\n", time.Now().Unix(), id, name)
+}
+
+func (r *GitLabReporter) EndGroup() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.sections) == 0 {
+		return
+	}
+	id := r.sections[len(r.sections)-1]
+	r.sections = r.sections[:len(r.sections)-1]
+	fmt.Fprintf(r.writer(), "\x1b[0Ksection_end:%d:%s\r\x1b[0K\n", time.Now().Unix(), id)
+}
+
+// Appends the output to the dotenv report, whose variables are passed to
+// later jobs. Dotenv variables cannot be masked, so secrets are refused.
+func (r *GitLabReporter) SetOutput(name string, value string, secret bool) error {
+
+	if secret {
+		return errors.New("sensitive outputs are not written to the dotenv report")
+	}
+	if !dotenvName.MatchString(name) {
+		return fmt.Errorf("'%s' is not a valid dotenv variable name", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return errors.New("multiline values are not supported by dotenv reports")
+	}
+	return appendFile(r.dotenv, name+"="+value+"\n")
+}
+
+// GitLab has no step summary.
+func (r *GitLabReporter) Summary(markdown string) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package ci
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reports to a terminal. Messages go to stderr so stdout only carries what
+// commands print, such as JSON.
+type PlainReporter struct {
+	out io.Writer
+}
+
+func NewPlainReporter() *PlainReporter {
+	return &PlainReporter{}
+}
+
+func (r *PlainReporter) writer() io.Writer {
+	if r.out != nil {
+		return r.out
+	}
+	return os.Stderr
+}
+
+func (r *PlainReporter) Info(message string) {
+	fmt.Fprintln(r.writer(), message)
+}
+
+func (r *PlainReporter) Warning(message string) {
+	fmt.Fprintf(r.writer(), "Warning: %s\n", message)
+}
+
+func (r *PlainReporter) Error(message string) {
+	fmt.Fprintf(r.writer(), "Error: %s\n", message)
+}
+
+func (r *PlainReporter) Section(message string) {
+	fmt.Fprintln(r.writer(), message)
+}
+
+func (r *PlainReporter) Group(name string) {
+	fmt.Fprintf(r.writer(), "==> %s\n", name)
+}
+
+func (r *PlainReporter) EndGroup() {}
+
+// Outputs are already printed by the commands that produce them.
+func (r *PlainReporter) SetOutput(name string, value string, secret bool) error {
+	return nil
+}
+
+func (r *PlainReporter) Summary(markdown string) error {
+	return nil
+}
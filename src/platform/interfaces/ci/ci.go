@@ -0,0 +1,99 @@
+package ci
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reporter emits logging commands and step outputs in the syntax of the CI
+// system running the CLI.
+type Reporter interface {
+	Info(message string)
+	Warning(message string)
+	Error(message string)
+	Section(message string)
+	Group(name string)
+	EndGroup()
+	SetOutput(name string, value string, secret bool) error
+	Summary(markdown string) error
+}
+
+// ProviderVariable selects the reporter instead of detecting it from the
+// environment. One of 'azuredevops', 'github', 'gitlab' or 'plain'.
+const ProviderVariable = "PLATFORM_CI"
+
+var providers = map[string]func(getenv func(string) string) Reporter{
+	"azuredevops": func(getenv func(string) string) Reporter { return NewAzureDevOpsReporter(getenv) },
+	"github":      func(getenv func(string) string) Reporter { return NewGitHubReporter(getenv) },
+	"gitlab":      func(getenv func(string) string) Reporter { return NewGitLabReporter(getenv) },
+	"plain":       func(getenv func(string) string) Reporter { return NewPlainReporter() },
+}
+
+// Detect returns the reporter of the CI system the environment belongs to,
+// or the plain reporter outside of CI.
+func Detect(getenv func(string) string) Reporter {
+
+	if provider, ok := providers[strings.ToLower(getenv(ProviderVariable))]; ok {
+		return provider(getenv)
+	}
+
+	switch {
+	case strings.EqualFold(getenv("TF_BUILD"), "true"):
+		return NewAzureDevOpsReporter(getenv)
+	case getenv("GITHUB_ACTIONS") == "true":
+		return NewGitHubReporter(getenv)
+	case getenv("GITLAB_CI") == "true":
+		return NewGitLabReporter(getenv)
+	}
+	return NewPlainReporter()
+}
+
+var reporter = Detect(os.Getenv)
+
+// Use replaces the reporter the package functions write to.
+func Use(r Reporter) {
+	reporter = r
+}
+
+func Info(format string, a ...any) {
+	reporter.Info(fmt.Sprintf(format, a...))
+}
+
+func Warning(format string, a ...any) {
+	reporter.Warning(fmt.Sprintf(format, a...))
+}
+
+func Error(format string, a ...any) {
+	reporter.Error(fmt.Sprintf(format, a...))
+}
+
+// Section highlights a line, such as the URL of a preview.
+func Section(format string, a ...any) {
+	reporter.Section(fmt.Sprintf(format, a...))
+}
+
+// Group starts a collapsible group of log lines, ended by EndGroup.
+func Group(format string, a ...any) {
+	reporter.Group(fmt.Sprintf(format, a...))
+}
+
+func EndGroup() {
+	reporter.EndGroup()
+}
+
+// SetOutput publishes a value to later steps of the pipeline. Failing to
+// publish it only warns.
+func SetOutput(name string, value string, secret bool) {
+	if err := reporter.SetOutput(name, value, secret); err != nil {
+		Warning("Failed to set output '%s': %v", name, err)
+	}
+}
+
+// Summary adds Markdown to the summary of the pipeline run, where the CI
+// system has one. Failing to add it only warns.
+func Summary(markdown string) {
+	if err := reporter.Summary(markdown); err != nil {
+		Warning("Failed to write step summary: %v", err)
+	}
+}
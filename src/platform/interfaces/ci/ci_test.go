@@ -0,0 +1,246 @@
+package ci
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestDetect(t *testing.T) {
+
+	cases := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"terminal", map[string]string{}, "plain"},
+		{"azure devops", map[string]string{"TF_BUILD": "True"}, "azuredevops"},
+		{"github", map[string]string{"GITHUB_ACTIONS": "true"}, "github"},
+		{"gitlab", map[string]string{"GITLAB_CI": "true"}, "gitlab"},
+		{"override", map[string]string{"TF_BUILD": "True", ProviderVariable: "plain"}, "plain"},
+		{"unknown override", map[string]string{"GITLAB_CI": "true", ProviderVariable: "jenkins"}, "gitlab"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := typeName(Detect(env(c.vars))); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func typeName(r Reporter) string {
+	switch r.(type) {
+	case *AzureDevOpsReporter:
+		return "azuredevops"
+	case *GitHubReporter:
+		return "github"
+	case *GitLabReporter:
+		return "gitlab"
+	case *PlainReporter:
+		return "plain"
+	}
+	return "unknown"
+}
+
+func TestAzureDevOpsReporter(t *testing.T) {
+
+	var out bytes.Buffer
+	tempdir := t.TempDir()
+	r := NewAzureDevOpsReporter(env(map[string]string{"AGENT_TEMPDIRECTORY": tempdir}))
+	r.out = &out
+
+	r.Group("Terraform Output")
+	r.Warning("Workspace expires soon")
+	r.SetOutput("app_hostname", "api.example.com", false)
+	r.SetOutput("password", "50%\nof it", true)
+	r.EndGroup()
+	if err := r.Summary("| Output | Value |"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"##[group]Terraform Output\n",
+		"##[warning] Workspace expires soon\n",
+		"##vso[task.setvariable variable=app_hostname;isOutput=true]api.example.com\n",
+		"##vso[task.setvariable variable=password;isOutput=true;issecret=true]50%AZP25%0Aof it\n",
+		"##[endgroup]\n",
+		"##vso[task.uploadsummary]" + tempdir,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+}
+
+func TestAzureDevOpsReporterSkipsSummaryOffAgent(t *testing.T) {
+
+	var out bytes.Buffer
+	r := NewAzureDevOpsReporter(env(nil))
+	r.out = &out
+
+	if err := r.Summary("| Output | Value |"); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("got %q, want no summary uploaded", out.String())
+	}
+}
+
+func TestGitHubReporter(t *testing.T) {
+
+	var out bytes.Buffer
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output")
+	summary := filepath.Join(dir, "summary")
+	r := NewGitHubReporter(env(map[string]string{
+		"GITHUB_OUTPUT":       output,
+		"GITHUB_STEP_SUMMARY": summary,
+	}))
+	r.out = &out
+
+	r.Group("Terraform Output")
+	r.Error("Run had errors!\nSee the logs")
+	if err := r.SetOutput("app_hostname", "api.example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetOutput("password", "hunter2", true); err != nil {
+		t.Fatal(err)
+	}
+	r.EndGroup()
+	if err := r.Summary("| Output | Value |"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"::group::Terraform Output\n",
+		"::error::Run had errors!%0ASee the logs\n",
+		"::add-mask::hunter2\n",
+		"::endgroup::\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+
+	written, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heredoc := regexp.MustCompile(`(?m)^(\w+)<<(ghadelimiter_[0-9a-f]+)\n(.*)\n(ghadelimiter_[0-9a-f]+)$`)
+	matches := heredoc.FindAllStringSubmatch(string(written), -1)
+	if len(matches) != 2 {
+		t.Fatalf("got %q, want two outputs", written)
+	}
+	for i, want := range [][2]string{{"app_hostname", "api.example.com"}, {"password", "hunter2"}} {
+		m := matches[i]
+		if m[1] != want[0] || m[3] != want[1] || m[2] != m[4] {
+			t.Errorf("got %q, want %s=%s", m[0], want[0], want[1])
+		}
+	}
+
+	if written, _ := os.ReadFile(summary); string(written) != "| Output | Value |\n" {
+		t.Errorf("got summary %q", written)
+	}
+}
+
+func TestGitHubReporterRequiresOutputFile(t *testing.T) {
+
+	r := NewGitHubReporter(env(nil))
+	r.out = &bytes.Buffer{}
+
+	if err := r.SetOutput("app_hostname", "api.example.com", false); err == nil {
+		t.Error("got no error, want GITHUB_OUTPUT to be required")
+	}
+}
+
+func TestGitLabReporter(t *testing.T) {
+
+	var out bytes.Buffer
+	dotenv := filepath.Join(t.TempDir(), "outputs.env")
+	r := NewGitLabReporter(env(map[string]string{DotenvVariable: dotenv}))
+	r.out = &out
+
+	r.Group("Create Workspace")
+	r.Group("Terraform Output")
+	r.EndGroup()
+	r.EndGroup()
+	r.EndGroup()
+
+	sections := regexp.MustCompile(`section_(start|end):\d+:(platform_\d+)`).FindAllStringSubmatch(out.String(), -1)
+	var got []string
+	for _, s := range sections {
+		got = append(got, s[1]+":"+s[2])
+	}
+	want := "start:platform_1 start:platform_2 end:platform_2 end:platform_1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got sections %v, want %s", got, want)
+	}
+
+	if err := r.SetOutput("eastus_app_hostname", "api.example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetOutput("password", "hunter2", true); err == nil {
+		t.Error("got no error, want secrets refused")
+	}
+	if err := r.SetOutput("app-hostname", "api.example.com", false); err == nil {
+		t.Error("got no error, want invalid names refused")
+	}
+	if err := r.SetOutput("certificate", "line 1\nline 2", false); err == nil {
+		t.Error("got no error, want multiline values refused")
+	}
+
+	if written, _ := os.ReadFile(dotenv); string(written) != "eastus_app_hostname=api.example.com\n" {
+		t.Errorf("got dotenv %q", written)
+	}
+}
+
+func TestGitLabReporterDefaultsDotenv(t *testing.T) {
+	if r := NewGitLabReporter(env(nil)); r.dotenv != "platform.env" {
+		t.Errorf("got %q, want platform.env", r.dotenv)
+	}
+}
+
+func TestPlainReporter(t *testing.T) {
+
+	var out bytes.Buffer
+	r := NewPlainReporter()
+	r.out = &out
+
+	r.Group("Create Workspace")
+	r.Info("Workspace created")
+	r.Warning("Rolling back")
+	r.EndGroup()
+	if err := r.SetOutput("password", "hunter2", true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "==> Create Workspace\nWorkspace created\nWarning: Rolling back\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestSetOutputWarnsOnFailure(t *testing.T) {
+
+	var out bytes.Buffer
+	r := NewGitHubReporter(env(nil))
+	r.out = &out
+
+	previous := reporter
+	Use(r)
+	t.Cleanup(func() { Use(previous) })
+
+	SetOutput("app_hostname", "api.example.com", false)
+	if !strings.Contains(out.String(), "::warning::Failed to set output 'app_hostname'") {
+		t.Errorf("got %q, want a warning", out.String())
+	}
+}
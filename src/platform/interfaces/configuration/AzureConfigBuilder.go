@@ -2,10 +2,12 @@ package config
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net/url"
-	"path"
+	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azappconfig"
@@ -13,11 +15,15 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// Credential, Client and ClientOptions may be set before the builder is used
+// to replace the default Azure credential and clients.
 type AzureConfigBuilder struct {
 	Endpoint      string
-	Credential    *azidentity.DefaultAzureCredential
+	Credential    azcore.TokenCredential
 	Client        *azappconfig.Client
+	ClientOptions policy.ClientOptions
 	Configuration Configuration
+	secretClients map[string]*azsecrets.Client
 }
 
 // AZ Builder Functions
@@ -25,69 +31,115 @@ func newAzureConfigBuilder() *AzureConfigBuilder {
 	return &AzureConfigBuilder{}
 }
 
-func setAzureCredential(b *AzureConfigBuilder) {
+func setAzureCredential(b *AzureConfigBuilder) error {
+
+	if b.Credential != nil {
+		return nil
+	}
 
 	credential, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
-		log.Fatal("Failed to initialize client: ", err)
+		return fmt.Errorf("failed to initialize credential: %w", err)
 	}
 	b.Credential = credential
+	return nil
 
 }
 
-func getAppConfigClient(b *AzureConfigBuilder) {
+func getAppConfigClient(b *AzureConfigBuilder) error {
+
+	if b.Client != nil {
+		return nil
+	}
 
-	client, err := azappconfig.NewClient(b.Endpoint, b.Credential, nil)
+	client, err := azappconfig.NewClient(b.Endpoint, b.Credential, &azappconfig.ClientOptions{
+		ClientOptions: b.ClientOptions,
+	})
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to initialize App Configuration client: %w", err)
 	}
 	b.Client = client
+	return nil
 
 }
 
-func getSecretByUri(credential *azidentity.DefaultAzureCredential, reference string) string {
+// Returns a client for the vault, reusing one per vault.
+func getSecretClient(b *AzureConfigBuilder, vault string) (*azsecrets.Client, error) {
 
-	u, err := url.Parse(reference)
+	if client, ok := b.secretClients[vault]; ok {
+		return client, nil
+	}
+
+	client, err := azsecrets.NewClient(vault, b.Credential, &azsecrets.ClientOptions{
+		ClientOptions: b.ClientOptions,
+	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to initialize Key Vault client: %w", err)
 	}
 
-	kvUri := "https://" + u.Host
-	kvSecret := path.Base(reference)
+	if b.secretClients == nil {
+		b.secretClients = make(map[string]*azsecrets.Client)
+	}
+	b.secretClients[vault] = client
+	return client, nil
+
+}
+
+// Resolves a Key Vault reference of the form
+// https://<vault>/secrets/<name>[/<version>].
+func getSecretByUri(b *AzureConfigBuilder, reference string) (string, error) {
 
-	client, err := azsecrets.NewClient(kvUri, credential, nil)
+	u, err := url.Parse(reference)
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("invalid Key Vault reference '%s': %w", reference, err)
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[0] != "secrets" {
+		return "", fmt.Errorf("invalid Key Vault reference '%s'", reference)
 	}
 
-	// Get a secret. An empty string version gets the latest version of the secret.
+	kvUri := "https://" + u.Host
+	kvSecret := segments[1]
+
+	// An empty string version gets the latest version of the secret.
 	version := ""
+	if len(segments) == 3 {
+		version = segments[2]
+	}
+
+	client, err := getSecretClient(b, kvUri)
+	if err != nil {
+		return "", err
+	}
 	resp, err := client.GetSecret(context.TODO(), kvSecret, version, nil)
 	if err != nil {
-		log.Fatalf("failed to get the secret: %v", err)
+		return "", fmt.Errorf("failed to get the secret: %w", err)
 	}
 
 	// Set Value and Return
 	value := *resp.Value
-	return value
+	return value, nil
 
 }
 
 // Core Builder Functions
-func (b *AzureConfigBuilder) setClient(endpoint string) {
+func (b *AzureConfigBuilder) setClient(endpoint string) error {
 
 	// Set App Config Store Endpoint
 	b.Endpoint = endpoint
 
 	// Get Cloud Credential
-	setAzureCredential(b)
+	if err := setAzureCredential(b); err != nil {
+		return err
+	}
 
 	// Create Client of the App Config Store
-	getAppConfigClient(b)
+	return getAppConfigClient(b)
 
 }
 
-func (b *AzureConfigBuilder) getConfig(labels []string) *Configuration {
+func (b *AzureConfigBuilder) getConfig(labels []string) (*Configuration, error) {
 
 	var (
 		key KeyValue
@@ -106,27 +158,36 @@ func (b *AzureConfigBuilder) getConfig(labels []string) *Configuration {
 			},
 			nil)
 
-		if revPgr.More() {
-			if revResp, revErr := revPgr.NextPage(context.TODO()); revErr == nil {
-				for _, setting := range revResp.Settings {
-					key.Name = *setting.Key
-					if gjson.Valid(*setting.Value) {
-						result := gjson.Get(*setting.Value, "uri")
-						if result.Exists() {
-							key.Value = getSecretByUri(b.Credential, result.String())
-						} else {
-							key.Value = *setting.Value
+		for revPgr.More() {
+			revResp, revErr := revPgr.NextPage(context.TODO())
+			if revErr != nil {
+				return nil, fmt.Errorf("failed to list settings for label '%s': %w", label, revErr)
+			}
+			for _, setting := range revResp.Settings {
+				key.Name = *setting.Key
+				if gjson.Valid(*setting.Value) {
+					result := gjson.Get(*setting.Value, "uri")
+					if result.Exists() {
+						value, err := getSecretByUri(b, result.String())
+						if err != nil {
+							return nil, err
 						}
+						key.Value = value
 					} else {
 						key.Value = *setting.Value
 					}
+				} else {
+					key.Value = *setting.Value
+				}
+				key.ContentType = ""
+				if setting.ContentType != nil {
 					key.ContentType = *setting.ContentType
-					configmap[*setting.Key] = key
 				}
+				configmap[*setting.Key] = key
 			}
 		}
 	}
 
 	b.Configuration.List = configmap
-	return to.Ptr(b.Configuration)
+	return to.Ptr(b.Configuration), nil
 }
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"main/interfaces/configuration/azuretest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestBuilder(srv *azuretest.Server) (*AzureConfigBuilder, *azuretest.Credential) {
+	credential := &azuretest.Credential{}
+	return &AzureConfigBuilder{
+		Credential:    credential,
+		ClientOptions: srv.ClientOptions(),
+	}, credential
+}
+
+func build(t *testing.T, srv *azuretest.Server, labels ...string) *Configuration {
+	t.Helper()
+
+	b, _ := newTestBuilder(srv)
+	c, err := NewDirector(b).Build(azuretest.Endpoint, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGetConfigLayersLabels(t *testing.T) {
+
+	srv := azuretest.NewServer()
+	srv.AddSetting(azuretest.Setting{Key: "TTL", Label: "platform-preview", Value: "4h"})
+	srv.AddSetting(azuretest.Setting{Key: "MAX_TTL", Label: "platform-preview", Value: "72h"})
+	srv.AddSetting(azuretest.Setting{Key: "TTL", Label: "platform-preview-sub", Value: "8h"})
+	srv.AddSetting(azuretest.Setting{Key: "TTL", Label: "platform-preview-sub-api", Value: "24h", ContentType: "text/plain"})
+	srv.AddSetting(azuretest.Setting{Key: "TTL", Label: "platform-preview-sub-web", Value: "1h"})
+	srv.AddSetting(azuretest.Setting{Key: "TTL", Value: "unlabeled"})
+
+	c := build(t, srv, "platform-preview", "platform-preview-sub", "platform-preview-sub-api")
+
+	if got := c.List["TTL"]; got.Value != "24h" || got.ContentType != "text/plain" {
+		t.Errorf("TTL = %+v, want the most specific label to win", got)
+	}
+	if got := c.List["MAX_TTL"].Value; got != "72h" {
+		t.Errorf("MAX_TTL = %q, want it inherited from the base label", got)
+	}
+	if len(c.List) != 2 {
+		t.Errorf("got %d keys, want 2: %v", len(c.List), c.List)
+	}
+
+	c = build(t, srv, "platform-preview", "platform-preview-sub-web", "platform-preview-sub")
+	if got := c.List["TTL"].Value; got != "8h" {
+		t.Errorf("TTL = %q, want later labels to override earlier ones", got)
+	}
+}
+
+func TestGetConfigResolvesKeyVaultReferences(t *testing.T) {
+
+	srv := azuretest.NewServer()
+	first := srv.AddSecret("platform.vault.azure.net", "client-secret", "v1")
+	srv.AddSecret("platform.vault.azure.net", "client-secret", "v2")
+	srv.AddSecret("other.vault.azure.net", "token", "other")
+
+	srv.AddKeyVaultReference("LATEST", "platform", azuretest.SecretURI("platform.vault.azure.net", "client-secret", ""))
+	srv.AddKeyVaultReference("PINNED", "platform", first)
+	srv.AddKeyVaultReference("OTHER", "platform", azuretest.SecretURI("other.vault.azure.net", "token", ""))
+	srv.AddSetting(azuretest.Setting{Key: "TFC_VARIABLES", Label: "platform", Value: `[{"key":"ARM_CLIENT_ID","category":"env"}]`})
+
+	b, credential := newTestBuilder(srv)
+	c, err := NewDirector(b).Build(azuretest.Endpoint, []string{"platform"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"LATEST":        "v2",
+		"PINNED":        "v1",
+		"OTHER":         "other",
+		"TFC_VARIABLES": `[{"key":"ARM_CLIENT_ID","category":"env"}]`,
+	}
+	for key, value := range want {
+		if got := c.List[key].Value; got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if got := c.List["LATEST"].ContentType; got != azuretest.KeyVaultReferenceContentType {
+		t.Errorf("content type = %q, want the Key Vault reference content type", got)
+	}
+
+	// Clients are reused per vault, so each is challenged once
+	challenges := 0
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, "GET /secrets/") {
+			challenges++
+		}
+	}
+	if challenges != 3+2 {
+		t.Errorf("got %d secret requests, want 3 reads and 2 challenges", challenges)
+	}
+	if !slices.Contains(credential.Scopes(), "https://vault.azure.net/.default") {
+		t.Errorf("scopes %v missing the Key Vault scope", credential.Scopes())
+	}
+}
+
+func TestGetConfigReadsAllPages(t *testing.T) {
+
+	srv := azuretest.NewServer()
+	srv.PageSize = 2
+	keys := []string{"A", "B", "C", "D", "E"}
+	for _, key := range keys {
+		srv.AddSetting(azuretest.Setting{Key: key, Label: "platform", Value: strings.ToLower(key)})
+	}
+	srv.AddSetting(azuretest.Setting{Key: "F", Label: "platform-other", Value: "f"})
+
+	c := build(t, srv, "platform")
+
+	if len(c.List) != len(keys) {
+		t.Errorf("got %d keys, want %d: %v", len(c.List), len(keys), c.List)
+	}
+	for _, key := range keys {
+		if got := c.List[key].Value; got != strings.ToLower(key) {
+			t.Errorf("%s = %q, want %q", key, got, strings.ToLower(key))
+		}
+	}
+
+	pages := 0
+	for _, r := range srv.Requests() {
+		if r == "GET /kv" {
+			pages++
+		}
+	}
+	if pages != 3 {
+		t.Errorf("got %d list requests, want 3 pages", pages)
+	}
+}
+
+func TestGetConfigReturnsSecretErrors(t *testing.T) {
+
+	srv := azuretest.NewServer()
+	srv.AddKeyVaultReference("BROKEN", "platform", "https://platform.vault.azure.net/keys/client-secret")
+	srv.AddKeyVaultReference("MISSING", "other", azuretest.SecretURI("platform.vault.azure.net", "missing", ""))
+
+	for label, want := range map[string]string{
+		"platform": "invalid Key Vault reference",
+		"other":    "failed to get the secret",
+	} {
+		b, _ := newTestBuilder(srv)
+		if _, err := NewDirector(b).Build(azuretest.Endpoint, []string{label}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", label, err, want)
+		}
+	}
+}
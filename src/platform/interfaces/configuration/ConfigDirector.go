@@ -10,9 +10,10 @@ func NewDirector(b IConfigurationBuilder) *ConfigurationDirector {
 	}
 }
 
-func (d *ConfigurationDirector) Build(endpoint string, labels []string) *Configuration {
-	d.builder.setClient(endpoint)
-	config := d.builder.getConfig(labels)
-	return config
+func (d *ConfigurationDirector) Build(endpoint string, labels []string) (*Configuration, error) {
+	if err := d.builder.setClient(endpoint); err != nil {
+		return nil, err
+	}
+	return d.builder.getConfig(labels)
 
 }
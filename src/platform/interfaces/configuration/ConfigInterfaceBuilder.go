@@ -1,8 +1,8 @@
 package config
 
 type IConfigurationBuilder interface {
-	setClient(endpoint string)
-	getConfig(labels []string) *Configuration
+	setClient(endpoint string) error
+	getConfig(labels []string) (*Configuration, error)
 }
 
 func GetBuilder(builderType string) IConfigurationBuilder {
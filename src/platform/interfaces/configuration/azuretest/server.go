@@ -0,0 +1,321 @@
+// Package azuretest provides an in-process fake of the App Configuration
+// list-settings API and the Key Vault get-secret API, along with a stub
+// credential, so the Azure configuration builder can run without Azure.
+package azuretest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+const (
+	// Endpoint of the fake App Configuration store.
+	Endpoint = "https://platform.azconfig.io"
+
+	// Token issued by the stub credential and required by the fake.
+	Token = "fake-token"
+
+	// Content type App Configuration gives Key Vault references.
+	KeyVaultReferenceContentType = "application/vnd.microsoft.appconfig.keyvaultref+json;charset=utf-8"
+
+	keyVaultResource = "https://vault.azure.net"
+	keyVaultTenant   = "00000000-0000-0000-0000-000000000000"
+)
+
+// Server answers App Configuration and Key Vault requests for any host. It
+// implements policy.Transporter so it can be set as a client's transport.
+type Server struct {
+	// Maximum number of settings returned per page.
+	PageSize int
+
+	mu       sync.Mutex
+	settings []Setting
+	secrets  map[string][]Secret
+	requests []string
+}
+
+type Setting struct {
+	Key         string
+	Label       string
+	Value       string
+	ContentType string
+}
+
+type Secret struct {
+	Version string
+	Value   string
+}
+
+func NewServer() *Server {
+	return &Server{
+		PageSize: 100,
+		secrets:  make(map[string][]Secret),
+	}
+}
+
+// AddSetting stores a key-value, replacing any with the same key and label.
+func (s *Server) AddSetting(setting Setting) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings = slices.DeleteFunc(s.settings, func(other Setting) bool {
+		return other.Key == setting.Key && other.Label == setting.Label
+	})
+	s.settings = append(s.settings, setting)
+}
+
+// AddSecret stores a new version of a secret in vault and returns its URI.
+// The most recently added version is the latest.
+func (s *Server) AddSecret(vault string, name string, value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := vault + "/" + name
+	version := fmt.Sprintf("%032d", len(s.secrets[id])+1)
+	s.secrets[id] = append(s.secrets[id], Secret{Version: version, Value: value})
+
+	return SecretURI(vault, name, version)
+}
+
+// AddKeyVaultReference stores a setting referencing a Key Vault secret.
+func (s *Server) AddKeyVaultReference(key string, label string, uri string) {
+	value, _ := json.Marshal(map[string]string{"uri": uri})
+	s.AddSetting(Setting{
+		Key:         key,
+		Label:       label,
+		Value:       string(value),
+		ContentType: KeyVaultReferenceContentType,
+	})
+}
+
+// SecretURI returns the identifier of a secret. An empty version refers to
+// the latest version.
+func SecretURI(vault string, name string, version string) string {
+	uri := "https://" + vault + "/secrets/" + name
+	if len(version) != 0 {
+		uri += "/" + version
+	}
+	return uri
+}
+
+// Requests returns the method and path of every request received.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.requests)
+}
+
+// ClientOptions routes a client's requests to the fake.
+func (s *Server) ClientOptions() policy.ClientOptions {
+	return policy.ClientOptions{
+		Transport: s,
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+	}
+}
+
+// Do serves a request in-process.
+func (s *Server) Do(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	authorized := r.Header.Get("Authorization") == "Bearer "+Token
+
+	switch {
+	case strings.HasSuffix(r.URL.Host, ".vault.azure.net"):
+		if !authorized {
+			// Key Vault clients only authenticate after being challenged
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer authorization="https://login.microsoftonline.com/%s", resource="%s"`, keyVaultTenant, keyVaultResource))
+			writeError(w, http.StatusUnauthorized, "Unauthorized", "AKV10000: Request is missing a Bearer or PoP token.")
+			return
+		}
+		s.getSecret(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/kv":
+		if !authorized {
+			writeError(w, http.StatusUnauthorized, "Unauthorized", "Invalid access token")
+			return
+		}
+		s.listSettings(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", "no fake for "+r.Method+" "+r.URL.String())
+	}
+}
+
+// Matches a value against a comma separated filter. '*' matches everything,
+// a trailing '*' matches a prefix and '\0' matches an empty value.
+func matchFilter(filter string, value string) bool {
+	for _, f := range strings.Split(filter, ",") {
+		switch {
+		case f == "*":
+			return true
+		case f == "\x00":
+			if len(value) == 0 {
+				return true
+			}
+		case strings.HasSuffix(f, "*"):
+			if strings.HasPrefix(value, strings.TrimSuffix(f, "*")) {
+				return true
+			}
+		case f == value:
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) listSettings(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	key := query.Get("key")
+	if len(key) == 0 {
+		key = "*"
+	}
+	label, ok := query["label"]
+	if !ok {
+		label = []string{"\x00"}
+	}
+	after, _ := strconv.Atoi(query.Get("after"))
+
+	var matches []Setting
+	for _, setting := range s.settings {
+		if matchFilter(key, setting.Key) && matchFilter(label[0], setting.Label) {
+			matches = append(matches, setting)
+		}
+	}
+	slices.SortFunc(matches, func(a, b Setting) int {
+		return strings.Compare(a.Key+"\x00"+a.Label, b.Key+"\x00"+b.Label)
+	})
+
+	start := min(after, len(matches))
+	end := min(start+s.PageSize, len(matches))
+
+	items := []map[string]interface{}{}
+	for _, setting := range matches[start:end] {
+		var label interface{}
+		if len(setting.Label) != 0 {
+			label = setting.Label
+		}
+		items = append(items, map[string]interface{}{
+			"key":           setting.Key,
+			"label":         label,
+			"value":         setting.Value,
+			"content_type":  setting.ContentType,
+			"etag":          strconv.Itoa(len(setting.Key + setting.Value)),
+			"last_modified": time.Unix(0, 0).UTC().Format(time.RFC3339),
+			"locked":        false,
+			"tags":          map[string]string{},
+		})
+	}
+
+	body := map[string]interface{}{"items": items}
+	if end < len(matches) {
+		next := url.Values{}
+		next.Set("key", key)
+		next.Set("label", label[0])
+		next.Set("after", strconv.Itoa(end))
+		next.Set("api-version", query.Get("api-version"))
+		body["@nextLink"] = "/kv?" + next.Encode()
+	}
+
+	w.Header().Set("Sync-Token", "fake=MQ==;sn=1")
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) getSecret(w http.ResponseWriter, r *http.Request) {
+
+	seg := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method != http.MethodGet || len(seg) < 2 || len(seg) > 3 || seg[0] != "secrets" {
+		writeError(w, http.StatusNotFound, "NotFound", "no fake for "+r.Method+" "+r.URL.Path)
+		return
+	}
+
+	var (
+		vault    = r.URL.Host
+		name     = seg[1]
+		versions = s.secrets[vault+"/"+name]
+	)
+	if len(versions) == 0 {
+		writeError(w, http.StatusNotFound, "SecretNotFound", fmt.Sprintf("A secret with (name/id) %s was not found in this key vault.", name))
+		return
+	}
+
+	secret := versions[len(versions)-1]
+	if len(seg) == 3 && len(seg[2]) != 0 {
+		i := slices.IndexFunc(versions, func(v Secret) bool { return v.Version == seg[2] })
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "SecretNotFound", fmt.Sprintf("A secret with (name/id) %s/%s was not found in this key vault.", name, seg[2]))
+			return
+		}
+		secret = versions[i]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":    SecretURI(vault, name, secret.Version),
+		"value": secret.Value,
+		"attributes": map[string]interface{}{
+			"enabled": true,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// Credential is a stub token credential recording the scopes requested.
+type Credential struct {
+	mu     sync.Mutex
+	scopes []string
+}
+
+func (c *Credential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scopes = append(c.scopes, options.Scopes...)
+	return azcore.AccessToken{Token: Token, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// Scopes returns every scope a token was requested for.
+func (c *Credential) Scopes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.scopes)
+}
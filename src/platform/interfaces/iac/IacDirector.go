@@ -1,12 +1,18 @@
 package iac
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	ci "main/interfaces/ci"
 	config "main/interfaces/configuration"
+	"strconv"
+	"time"
 )
 
 type IacDirector struct {
 	builder IIacBuilder
+	config  *config.Configuration
 }
 
 func NewDirector(b IIacBuilder) *IacDirector {
@@ -15,27 +21,209 @@ func NewDirector(b IIacBuilder) *IacDirector {
 	}
 }
 
-func (d *IacDirector) Build(config *config.Configuration) Iac {
+// KeepOnFailure reports whether a preview that failed to build should be
+// left in place for debugging instead of being rolled back.
+func KeepOnFailure(c *config.Configuration) bool {
+	enabled, _ := strconv.ParseBool(c.List["KEEP_ON_FAILURE"].Value)
+	return enabled
+}
+
+func (d *IacDirector) Build(ctx context.Context, config *config.Configuration) (Iac, error) {
+
+	d.config = config
+
+	ci.Group("Create Workspace")
+	if err := d.builder.createWorkspace(ctx, config); err != nil {
+		ci.EndGroup()
+		return d.builder.getWorkspace(), d.rollback(ctx, err)
+	}
+	err := d.builder.setVariables(ctx)
+	ci.EndGroup()
+
+	if err != nil {
+		return d.builder.getWorkspace(), d.rollback(ctx, err)
+	}
+	return d.builder.getWorkspace(), nil
+}
+
+func (d *IacDirector) Run(ctx context.Context) error {
+
+	if err := d.builder.runWorkspace(ctx, "apply"); err != nil {
+		return d.rollback(ctx, err)
+	}
+	return d.builder.getOutput(ctx)
+
+}
+
+// Returns the outputs of the workspace built by Build and Run.
+func (d *IacDirector) RunOutputs(ctx context.Context) ([]Output, error) {
+
+	return d.builder.getOutputs(ctx)
+
+}
+
+// Returns the status of the workspace built by Build and Run.
+func (d *IacDirector) RunStatus(ctx context.Context) (Status, error) {
+
+	return d.builder.getStatus(ctx)
+
+}
+
+// Returns the name of the workspace the director last built or found.
+func (d *IacDirector) WorkspaceName() string {
+
+	return d.builder.getWorkspace().name
+
+}
+
+// Returns the service of the workspace the director last found.
+func (d *IacDirector) WorkspaceService() (string, error) {
+
+	return ServiceFromTags(d.builder.getWorkspace().tags)
+
+}
+
+// Undoes a failed Build or Run of a workspace this director created. Empty
+// workspaces are deleted and half-applied ones destroyed first, unless
+// KEEP_ON_FAILURE is set. Workspaces that already existed are left alone.
+func (d *IacDirector) rollback(ctx context.Context, cause error) error {
+
+	ws := d.builder.getWorkspace()
+	if !ws.created || errors.Is(cause, ErrInterrupted) {
+		return cause
+	}
+
+	// Roll back even when the failure was a cancellation
+	ctx = context.WithoutCancel(ctx)
+
+	count, err := d.builder.getResourceCount(ctx)
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to read resource count: %w", err))
+	}
+
+	if d.config != nil && KeepOnFailure(d.config) {
+		ci.Warning("Keeping workspace '%s' with '%d' resource(s) for debugging", ws.name, count)
+		return cause
+	}
+
+	ci.Warning("Rolling back workspace '%s'", ws.name)
+	if count > 0 {
+		if err := d.builder.runWorkspace(ctx, "destroy"); err != nil {
+			return errors.Join(cause, fmt.Errorf("failed to destroy workspace '%s': %w", ws.name, err))
+		}
+	}
+	if err := d.builder.deleteWorkspace(ctx); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to delete workspace '%s': %w", ws.name, err))
+	}
+
+	return cause
+}
+
+func (d *IacDirector) Dismantle(ctx context.Context, config *config.Configuration) error {
+
+	if err := d.builder.findWorkspace(ctx, config); err != nil {
+		return err
+	}
+	if err := d.builder.runWorkspace(ctx, "destroy"); err != nil {
+		return err
+	}
+	return d.builder.deleteWorkspace(ctx)
+
+}
+
+func (d *IacDirector) List(ctx context.Context, config *config.Configuration) ([]Preview, error) {
+
+	return d.builder.listWorkspaces(ctx, config)
+
+}
+
+// Reports whether a workspace exists anywhere the backend keeps them, not
+// only among the previews List returned. Call it after List.
+func (d *IacDirector) Exists(ctx context.Context, name string) (bool, error) {
 
-	fmt.Println("[group]Create Workspace")
-	d.builder.createWorkspace(config)
-	d.builder.setVariables()
-	fmt.Println("[endgroup]")
+	return d.builder.workspaceExists(ctx, name)
 
-	return d.builder.getWorkspace()
 }
 
-func (d *IacDirector) Run() {
+// Looks up the workspace selected by the configuration without acting on it.
+func (d *IacDirector) Find(ctx context.Context, config *config.Configuration) error {
 
-	d.builder.runWorkspace("apply")
-	d.builder.getOutput()
+	return d.builder.findWorkspace(ctx, config)
 
 }
 
-func (d *IacDirector) Dismantle(config *config.Configuration) {
+func (d *IacDirector) Extend(ctx context.Context, config *config.Configuration, by time.Duration) error {
+
+	if err := d.builder.findWorkspace(ctx, config); err != nil {
+		return err
+	}
+	if err := d.builder.extendWorkspace(ctx, by); err != nil {
+		return err
+	}
+	return d.builder.runWorkspace(ctx, "apply")
+
+}
+
+func (d *IacDirector) Outputs(ctx context.Context, config *config.Configuration) ([]Output, error) {
+
+	if err := d.builder.findWorkspace(ctx, config); err != nil {
+		return nil, err
+	}
+	return d.builder.getOutputs(ctx)
+
+}
+
+func (d *IacDirector) Status(ctx context.Context, config *config.Configuration) (Status, error) {
+
+	if err := d.builder.findWorkspace(ctx, config); err != nil {
+		return Status{}, err
+	}
+	return d.builder.getStatus(ctx)
+
+}
 
-	d.builder.findWorkspace(config)
-	d.builder.runWorkspace("destroy")
-	d.builder.deleteWorkspace()
+func (d *IacDirector) Cancel(ctx context.Context, config *config.Configuration, reason string) error {
+
+	if err := d.builder.findRun(ctx, config); err != nil {
+		return err
+	}
+	return d.builder.cancelRun(ctx, reason)
+
+}
+
+func (d *IacDirector) Discard(ctx context.Context, config *config.Configuration, reason string) error {
+
+	if err := d.builder.findRun(ctx, config); err != nil {
+		return err
+	}
+	return d.builder.discardRun(ctx, reason)
+
+}
+
+func (d *IacDirector) Lock(ctx context.Context, config *config.Configuration, reason string) error {
+
+	if err := d.findTarget(ctx, config); err != nil {
+		return err
+	}
+	return d.builder.lockWorkspace(ctx, reason)
+
+}
+
+func (d *IacDirector) Unlock(ctx context.Context, config *config.Configuration) error {
+
+	if err := d.findTarget(ctx, config); err != nil {
+		return err
+	}
+	return d.builder.unlockWorkspace(ctx)
+
+}
+
+// Workspaces can be targeted directly or through one of their runs.
+func (d *IacDirector) findTarget(ctx context.Context, config *config.Configuration) error {
+
+	if len(config.List["TFC_RUN"].Value) != 0 {
+		return d.builder.findRun(ctx, config)
+	}
+	return d.builder.findWorkspace(ctx, config)
 
 }
@@ -1,21 +1,46 @@
 package iac
 
-import config "main/interfaces/configuration"
+import (
+	"context"
+	"errors"
+	config "main/interfaces/configuration"
+	"time"
+)
+
+// ErrInterrupted is returned when the user interrupts a run and chooses to
+// leave it running.
+var ErrInterrupted = errors.New("interrupted")
 
 type IIacBuilder interface {
-	createWorkspace(*config.Configuration)
-	findWorkspace(*config.Configuration)
-	setVariables()
-	runWorkspace(string)
-	deleteWorkspace()
-	getOutput()
+	createWorkspace(context.Context, *config.Configuration) error
+	findWorkspace(context.Context, *config.Configuration) error
+	listWorkspaces(context.Context, *config.Configuration) ([]Preview, error)
+	workspaceExists(context.Context, string) (bool, error)
+	findRun(context.Context, *config.Configuration) error
+	cancelRun(context.Context, string) error
+	discardRun(context.Context, string) error
+	lockWorkspace(context.Context, string) error
+	unlockWorkspace(context.Context) error
+	setVariables(context.Context) error
+	extendWorkspace(context.Context, time.Duration) error
+	runWorkspace(context.Context, string) error
+	deleteWorkspace(context.Context) error
+	getOutput(context.Context) error
+	getOutputs(context.Context) ([]Output, error)
+	getResourceCount(context.Context) (int, error)
+	getStatus(context.Context) (Status, error)
 	getWorkspace() Iac
 }
 
+// GetBuilder returns the builder for a backend type. Terraform Cloud and
+// Terraform Enterprise share a builder, addressed by TFC_HOSTNAME.
 func GetBuilder(builderType string) IIacBuilder {
-	if builderType == "app.terraform.io" {
+	if builderType == "tfc" || builderType == "tfe" {
 		return newTfcIacBuilder()
 	}
+	if builderType == "local" {
+		return newLocalIacBuilder()
+	}
 
 	return nil
 }
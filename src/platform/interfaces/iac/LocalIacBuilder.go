@@ -0,0 +1,801 @@
+package iac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocalIacBuilder runs previews with a terraform or tofu binary on the
+// machine running the CLI. Each preview keeps its metadata, and its state
+// when using the local backend, in a directory under LOCAL_STATE_DIR.
+// Commands run against a temporary copy of LOCAL_SOURCE.
+type LocalIacBuilder struct {
+	Workspace Iac
+	config    *config.Configuration
+	binary    string
+	source    string
+	state_dir string
+	backend   string
+	self      *localWorkspace
+}
+
+// Persisted alongside each preview so it can be found and destroyed later
+// without the configuration it was created with.
+type localWorkspace struct {
+	Name             string              `json:"name"`
+	WorkingDirectory string              `json:"working_directory"`
+	BuildID          string              `json:"build_id"`
+	Tags             []string            `json:"tags"`
+	CreatedAt        time.Time           `json:"created_at"`
+	Locked           bool                `json:"locked"`
+	Variables        map[string]Variable `json:"variables"`
+	LastRun          *RunSummary         `json:"last_run,omitempty"`
+}
+
+// Mirrors the JSON written by 'terraform output -json'.
+type localOutput struct {
+	Sensitive bool            `json:"sensitive"`
+	Type      json.RawMessage `json:"type"`
+	Value     interface{}     `json:"value"`
+}
+
+func newLocalIacBuilder() *LocalIacBuilder {
+	return &LocalIacBuilder{}
+}
+
+// Helper Functions
+func setLocalExecutor(b *LocalIacBuilder, config *config.Configuration) error {
+
+	b.config = config
+
+	// Binary
+	b.binary = config.List["LOCAL_BINARY"].Value
+	if len(b.binary) == 0 {
+		for _, name := range []string{"tofu", "terraform"} {
+			if path, err := exec.LookPath(name); err == nil {
+				b.binary = path
+				break
+			}
+		}
+	}
+	if len(b.binary) == 0 {
+		return errors.New("neither 'tofu' nor 'terraform' found in PATH. Set LOCAL_BINARY")
+	}
+
+	// Terraform Source
+	b.source = config.List["LOCAL_SOURCE"].Value
+	if len(b.source) == 0 {
+		b.source = "."
+	}
+	source, err := filepath.Abs(b.source)
+	if err != nil {
+		return err
+	}
+	b.source = source
+
+	// State
+	b.state_dir = config.List["LOCAL_STATE_DIR"].Value
+	if len(b.state_dir) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		b.state_dir = filepath.Join(home, ".platform", "previews")
+	}
+	state_dir, err := filepath.Abs(b.state_dir)
+	if err != nil {
+		return err
+	}
+	b.state_dir = state_dir
+
+	b.backend = config.List["LOCAL_BACKEND"].Value
+	if len(b.backend) == 0 {
+		b.backend = "local"
+	}
+	if b.backend != "local" && b.backend != "azurerm" {
+		return fmt.Errorf("LOCAL_BACKEND '%s' not supported. Allowed Value: [local azurerm]", b.backend)
+	}
+
+	ci.Info("Using '%s' with the '%s' backend", b.binary, b.backend)
+	return nil
+}
+
+// Workspace names become directories under the state directory, so they
+// cannot hold path separators or refer to a parent directory.
+func checkLocalWorkspaceName(name string) error {
+	if len(name) == 0 || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid workspace name '%s'", name)
+	}
+	return nil
+}
+
+func workspaceDir(b *LocalIacBuilder, name string) string {
+	return filepath.Join(b.state_dir, name)
+}
+
+func readLocalWorkspace(b *LocalIacBuilder, name string) (*localWorkspace, bool, error) {
+
+	data, err := os.ReadFile(filepath.Join(workspaceDir(b, name), "metadata.json"))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var ws localWorkspace
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, false, fmt.Errorf("failed to read metadata of workspace '%s': %w", name, err)
+	}
+	return &ws, true, nil
+}
+
+// Reads every workspace under the state directory.
+func readLocalWorkspaces(b *LocalIacBuilder) ([]*localWorkspace, error) {
+
+	entries, err := os.ReadDir(b.state_dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var workspaces []*localWorkspace
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		ws, ok, err := readLocalWorkspace(b, entry.Name())
+		if err != nil {
+			return nil, err
+		} else if ok {
+			workspaces = append(workspaces, ws)
+		}
+	}
+	return workspaces, nil
+}
+
+func saveLocalWorkspace(b *LocalIacBuilder) error {
+
+	dir := workspaceDir(b, b.self.Name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(b.self, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Variables may include secrets
+	return os.WriteFile(filepath.Join(dir, "metadata.json"), data, 0600)
+}
+
+// Copies the Terraform source into dst, skipping VCS and Terraform data.
+func copySource(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0700)
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), ".tfstate") {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		_, err = io.Copy(out, in)
+		return err
+	})
+}
+
+// Writes the backend override and variable files into the working directory.
+func writeWorkingFiles(b *LocalIacBuilder, dir string) error {
+
+	var backend string
+	switch b.backend {
+	case "local":
+		backend = fmt.Sprintf("terraform {\n  backend \"local\" {\n    path = %q\n  }\n}\n",
+			filepath.Join(workspaceDir(b, b.self.Name), "terraform.tfstate"))
+	case "azurerm":
+		backend = fmt.Sprintf("terraform {\n  backend \"azurerm\" {\n    resource_group_name  = %q\n    storage_account_name = %q\n    container_name       = %q\n    key                  = %q\n  }\n}\n",
+			b.config.List["BACKEND_RESOURCE_GROUP"].Value,
+			b.config.List["BACKEND_STORAGE_ACCOUNT"].Value,
+			b.config.List["BACKEND_CONTAINER"].Value,
+			b.self.Name+".tfstate",
+		)
+	}
+
+	// HCL values are written verbatim, everything else as JSON strings
+	tfvars := make(map[string]string)
+	var hcl []string
+	for _, v := range b.self.Variables {
+		if v.Category != CategoryTerraform {
+			continue
+		}
+		if v.HCL {
+			hcl = append(hcl, v.Key+" = "+v.Value)
+		} else {
+			tfvars[v.Key] = v.Value
+		}
+	}
+	sort.Strings(hcl)
+
+	data, err := json.MarshalIndent(tfvars, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{
+		"platform_backend_override.tf": []byte(backend),
+		"platform.auto.tfvars.json":    data,
+		"platform_hcl.auto.tfvars":     []byte(strings.Join(hcl, "\n") + "\n"),
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prepares a temporary copy of the source and initializes it. The returned
+// function removes the copy.
+func prepareWorkingDirectory(ctx context.Context, b *LocalIacBuilder, stdout io.Writer) (string, func(), error) {
+
+	tmp, err := os.MkdirTemp("", "platform-"+b.self.Name+"-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	if err := copySource(b.source, tmp); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to copy Terraform source: %w", err)
+	}
+
+	dir := filepath.Join(tmp, b.self.WorkingDirectory)
+	if _, err := os.Stat(dir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("working directory '%s' not found in '%s'", b.self.WorkingDirectory, b.source)
+	}
+
+	if err := writeWorkingFiles(b, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	if err := terraform(ctx, b, dir, stdout, "init", "-input=false", "-reconfigure"); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to initialize working directory: %w", err)
+	}
+
+	return dir, cleanup, nil
+}
+
+// Runs the binary with the workspace's env variables.
+func terraform(ctx context.Context, b *LocalIacBuilder, dir string, stdout io.Writer, args ...string) error {
+
+	cmd := exec.CommandContext(ctx, b.binary, append([]string{"-chdir=" + dir}, args...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"TF_IN_AUTOMATION=1",
+		"TF_PLUGIN_CACHE_DIR="+filepath.Join(b.state_dir, ".plugin-cache"),
+	)
+	for _, v := range b.self.Variables {
+		if v.Category == CategoryEnv {
+			cmd.Env = append(cmd.Env, v.Key+"="+v.Value)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(b.state_dir, ".plugin-cache"), 0700); err != nil {
+		return err
+	}
+
+	return cmd.Run()
+}
+
+// Counts the resources in the workspace's state.
+func countResources(ctx context.Context, b *LocalIacBuilder) (int, error) {
+
+	dir, cleanup, err := prepareWorkingDirectory(ctx, b, io.Discard)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	var out strings.Builder
+	if err := terraform(ctx, b, dir, &out, "state", "list"); err != nil {
+		return 0, fmt.Errorf("failed to list state: %w", err)
+	}
+	return len(strings.Fields(out.String())), nil
+}
+
+func notSupported(operation string) error {
+	return fmt.Errorf("'%s' is not supported by the local executor", operation)
+}
+
+// Core Builder Functions
+func (b *LocalIacBuilder) findWorkspace(ctx context.Context, config *config.Configuration) error {
+
+	if err := setLocalExecutor(b, config); err != nil {
+		return err
+	}
+
+	target := config.List["TFC_WORKSPACE"].Value
+	tags := SelectorTags(config)
+
+	// Exact Name
+	if len(target) != 0 {
+		if err := checkLocalWorkspaceName(target); err != nil {
+			return err
+		}
+		ci.Info("Lookup '%s' workspace", target)
+		ws, ok, err := readLocalWorkspace(b, target)
+		if err != nil {
+			return err
+		} else if ok {
+			return b.useWorkspace(ws)
+		} else if len(tags) == 0 {
+			return fmt.Errorf("workspace '%s' not found in '%s'", target, b.state_dir)
+		}
+		ci.Info("Workspace '%s' not found. Searching by tags.", target)
+	}
+
+	if len(tags) == 0 {
+		return errors.New("a workspace name or selector is required")
+	}
+
+	// Tags
+	ci.Info("Lookup workspaces tagged '%s'", strings.Join(tags, ", "))
+	workspaces, err := readLocalWorkspaces(b)
+	if err != nil {
+		return err
+	}
+
+	var (
+		candidates []*localWorkspace
+		names      []string
+	)
+	for _, ws := range workspaces {
+		if matchesTags(ws.Tags, tags) {
+			candidates = append(candidates, ws)
+			names = append(names, ws.Name)
+		}
+	}
+
+	ci.Info("Found '%d' Workspace(s)", len(names))
+	if len(names) == 0 {
+		return fmt.Errorf("no workspace tagged '%s' in '%s'", strings.Join(tags, ", "), b.state_dir)
+	}
+
+	name, err := chooseWorkspace(names)
+	if err != nil {
+		return err
+	}
+	return b.useWorkspace(candidates[slices.Index(names, name)])
+}
+
+func (b *LocalIacBuilder) useWorkspace(ws *localWorkspace) error {
+	b.self = ws
+	b.Workspace.name = ws.Name
+	b.Workspace.tags = ws.Tags
+	b.Workspace.working_directory = ws.WorkingDirectory
+	ci.Info("Workspace '%s' exists", b.self.Name)
+	return nil
+}
+
+func (b *LocalIacBuilder) listWorkspaces(ctx context.Context, config *config.Configuration) ([]Preview, error) {
+
+	if err := setLocalExecutor(b, config); err != nil {
+		return nil, err
+	}
+
+	return listLocalPreviews(b)
+}
+
+func (b *LocalIacBuilder) workspaceExists(ctx context.Context, name string) (bool, error) {
+
+	if err := checkLocalWorkspaceName(name); err != nil {
+		return false, err
+	}
+	_, ok, err := readLocalWorkspace(b, name)
+	return ok, err
+}
+
+// Returns every workspace saved by the local executor.
+func listLocalPreviews(b *LocalIacBuilder) ([]Preview, error) {
+
+	workspaces, err := readLocalWorkspaces(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var previews []Preview
+	for _, ws := range workspaces {
+		preview := Preview{
+			Name:      ws.Name,
+			ID:        ws.Name,
+			Tags:      ws.Tags,
+			CreatedAt: ws.CreatedAt,
+		}
+		if ws.LastRun != nil {
+			preview.RunStatus = ws.LastRun.Status
+		}
+		if expiration, ok := ParseExpirationTags(ws.Tags); ok {
+			preview.Expiration = expiration
+		}
+		previews = append(previews, preview)
+	}
+
+	return previews, nil
+}
+
+func (b *LocalIacBuilder) createWorkspace(ctx context.Context, config *config.Configuration) error {
+
+	if err := setLocalExecutor(b, config); err != nil {
+		return err
+	}
+	if len(config.List["TFC_NOTIFICATIONS"].Value) != 0 {
+		ci.Warning("Notification configurations are not supported by the local backend")
+	}
+
+	service := config.List["SERVICE"].Value
+	environment := config.List["ENVIRONMENT"].Value
+	location := config.List["LOCATION"].Value
+
+	// Derive Workspace Name
+	key := GetWorkspaceKey(config)
+	build_id := RandStringBytes(4)
+	if key.IsDeterministic() {
+		build_id = key.ID()
+	}
+
+	name, err := key.Name(config.List["TFC_WORKSPACE_TEMPLATE"].Value, build_id)
+	if err != nil {
+		return fmt.Errorf("failed to render workspace name: %w", err)
+	}
+	if err := checkLocalWorkspaceName(name); err != nil {
+		return err
+	}
+	b.Workspace.name = name
+	b.Workspace.working_directory = "workspaces/" + service + "/" + environment + "/" + location
+
+	// Reuse Existing Workspace
+	ws, ok, err := readLocalWorkspace(b, name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		b.self = ws
+		ci.Info("Workspace '%s' exists. Queuing a new run.", b.self.Name)
+	} else {
+		previews, err := listLocalPreviews(b)
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(config, previews); err != nil {
+			return err
+		}
+
+		b.self = &localWorkspace{
+			Name:             name,
+			WorkingDirectory: b.Workspace.working_directory,
+			BuildID:          build_id,
+			Tags:             []string{service},
+			CreatedAt:        time.Now(),
+		}
+		if len(key.PullRequest) != 0 {
+			b.self.Tags = append(b.self.Tags, "pr:"+key.PullRequest)
+		} else if len(key.Branch) != 0 {
+			b.self.Tags = append(b.self.Tags, "branch:"+Slugify(key.Branch))
+		}
+		if len(location) != 0 {
+			b.self.Tags = append(b.self.Tags, LocationTagPrefix+location)
+		}
+		if owner := config.List["OWNER"].Value; len(owner) != 0 {
+			b.self.Tags = append(b.self.Tags, OwnerTag(owner))
+		}
+		b.Workspace.created = true
+		ci.Info("Workspace '%s' created", b.self.Name)
+	}
+
+	if expiration, ok := GetExpiration(config); ok {
+		b.self.Tags = replaceExpirationTag(b.self.Tags, expiration)
+	}
+
+	return saveLocalWorkspace(b)
+}
+
+func replaceExpirationTag(tags []string, expiration time.Time) []string {
+	var kept []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, ExpirationTagPrefix) {
+			kept = append(kept, tag)
+		}
+	}
+	return append(kept, ExpirationTag(expiration))
+}
+
+func (b *LocalIacBuilder) setVariables(ctx context.Context) error {
+
+	varmap, err := ResolveVariables(b.config)
+	if err != nil {
+		return err
+	}
+
+	build_id := Variable{
+		Key:      "BUILD_ID",
+		Value:    b.self.BuildID,
+		Category: CategoryTerraform,
+	}
+	varmap[build_id.id()] = build_id
+
+	// Without a new TTL, a reused workspace keeps the expiration of its tag
+	expiration, ok := GetExpiration(b.config)
+	if !ok {
+		expiration, ok = ParseExpirationTags(b.self.Tags)
+	}
+	if ok {
+		v := expirationVariable(expiration)
+		varmap[v.id()] = v
+	}
+
+	current := b.self.Variables[ownerVariable("").id()].Value
+	if v, ok := getOwnerVariable(b.config.List["OWNER"].Value, current); ok {
+		varmap[v.id()] = v
+	}
+
+	b.self.Variables = varmap
+	if err := saveLocalWorkspace(b); err != nil {
+		return err
+	}
+	ci.Info("Set '%d' variable(s)", len(varmap))
+	return nil
+}
+
+func (b *LocalIacBuilder) extendWorkspace(ctx context.Context, by time.Duration) error {
+
+	base := time.Now()
+	if current, ok := ParseExpirationTags(b.self.Tags); ok && current.After(base) {
+		base = current
+	}
+	expiration := base.Add(by)
+
+	if err := CheckExpiration(b.config, expiration); err != nil {
+		return err
+	}
+
+	v := expirationVariable(expiration)
+	if b.self.Variables == nil {
+		b.self.Variables = make(map[string]Variable)
+	}
+	b.self.Variables[v.id()] = v
+	b.self.Tags = replaceExpirationTag(b.self.Tags, expiration)
+	if err := saveLocalWorkspace(b); err != nil {
+		return err
+	}
+
+	ci.Info("Workspace expires at '%s'", expiration.Format(time.RFC3339))
+	return nil
+}
+
+func (b *LocalIacBuilder) runWorkspace(ctx context.Context, RunType string) error {
+
+	if b.self.Locked {
+		return fmt.Errorf("workspace '%s' is locked", b.self.Name)
+	}
+
+	ci.Group("Create Workspace Run")
+
+	dir, cleanup, err := prepareWorkingDirectory(ctx, b, os.Stdout)
+	if err != nil {
+		ci.EndGroup()
+		return err
+	}
+	defer cleanup()
+
+	args := []string{"apply", "-input=false", "-auto-approve"}
+	if strings.ToLower(RunType) == "destroy" {
+		args = []string{"destroy", "-input=false", "-auto-approve"}
+	}
+
+	started := time.Now()
+	run_err := terraform(ctx, b, dir, os.Stdout, args...)
+
+	status := "applied"
+	if run_err != nil {
+		status = "errored"
+	}
+	b.self.LastRun = &RunSummary{
+		ID:        started.Format("20060102T150405"),
+		Status:    status,
+		CreatedAt: started,
+		Duration:  time.Since(started).Round(time.Second).String(),
+	}
+	save_err := saveLocalWorkspace(b)
+
+	ci.EndGroup()
+
+	if run_err != nil {
+		ci.Error("Run had errors!")
+		return errors.Join(fmt.Errorf("run errored: %w", run_err), save_err)
+	}
+	ci.Section("Run finished with status %q", status)
+	return save_err
+}
+
+func (b *LocalIacBuilder) getOutputs(ctx context.Context) ([]Output, error) {
+
+	dir, cleanup, err := prepareWorkingDirectory(ctx, b, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var out strings.Builder
+	if err := terraform(ctx, b, dir, &out, "output", "-json"); err != nil {
+		return nil, fmt.Errorf("failed to read outputs: %w", err)
+	}
+
+	var raw map[string]localOutput
+	if err := json.Unmarshal([]byte(out.String()), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse outputs: %w", err)
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var outputs []Output
+	for _, name := range names {
+		o := raw[name]
+		var typ string
+		if err := json.Unmarshal(o.Type, &typ); err != nil {
+			typ = string(o.Type)
+		}
+		outputs = append(outputs, Output{
+			Name:      name,
+			Type:      typ,
+			Sensitive: o.Sensitive,
+			Value:     o.Value,
+		})
+	}
+
+	return outputs, nil
+}
+
+func (b *LocalIacBuilder) getOutput(ctx context.Context) error {
+
+	outputs, err := b.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	return printOutputs(b.self.Name, outputs)
+}
+
+func (b *LocalIacBuilder) getResourceCount(ctx context.Context) (int, error) {
+
+	// There is no state until the first run
+	if b.self.LastRun == nil {
+		return 0, nil
+	}
+	return countResources(ctx, b)
+}
+
+func (b *LocalIacBuilder) getStatus(ctx context.Context) (Status, error) {
+
+	status := Status{
+		Name:    b.self.Name,
+		ID:      b.self.Name,
+		URL:     "file://" + workspaceDir(b, b.self.Name),
+		Branch:  refFromTags(b.self.Tags),
+		Owner:   tagValue(b.self.Tags, OwnerTagPrefix),
+		Locked:  b.self.Locked,
+		Run:     b.self.LastRun,
+		Outputs: []Output{},
+	}
+
+	if expiration, ok := ParseExpirationTags(b.self.Tags); ok {
+		status.Expiration = &expiration
+	}
+
+	if b.self.LastRun != nil {
+		// A missing state only means nothing has been applied yet
+		if count, err := countResources(ctx, b); err == nil {
+			status.ResourceCount = count
+		}
+
+		outputs, err := b.getOutputs(ctx)
+		if err != nil {
+			return status, err
+		}
+		for _, output := range outputs {
+			status.Outputs = append(status.Outputs, output.Masked())
+		}
+	}
+
+	return status, nil
+}
+
+func (b *LocalIacBuilder) findRun(ctx context.Context, config *config.Configuration) error {
+	return notSupported("run lookup")
+}
+
+func (b *LocalIacBuilder) cancelRun(ctx context.Context, reason string) error {
+	return notSupported("cancel")
+}
+
+func (b *LocalIacBuilder) discardRun(ctx context.Context, reason string) error {
+	return notSupported("discard")
+}
+
+func (b *LocalIacBuilder) lockWorkspace(ctx context.Context, reason string) error {
+	b.self.Locked = true
+	if err := saveLocalWorkspace(b); err != nil {
+		return err
+	}
+	ci.Info("Workspace '%s' locked", b.self.Name)
+	return nil
+}
+
+func (b *LocalIacBuilder) unlockWorkspace(ctx context.Context) error {
+	b.self.Locked = false
+	if err := saveLocalWorkspace(b); err != nil {
+		return err
+	}
+	ci.Info("Workspace '%s' unlocked", b.self.Name)
+	return nil
+}
+
+func (b *LocalIacBuilder) deleteWorkspace(ctx context.Context) error {
+
+	if err := os.RemoveAll(workspaceDir(b, b.self.Name)); err != nil {
+		return err
+	}
+
+	ci.Info("Workspace '%s' deleted.", b.self.Name)
+	return nil
+}
+
+func (b *LocalIacBuilder) getWorkspace() Iac {
+	return b.Workspace
+}
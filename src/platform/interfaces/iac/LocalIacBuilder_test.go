@@ -0,0 +1,207 @@
+package iac
+
+import (
+	"context"
+	config "main/interfaces/configuration"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Uses only the null and random providers, so previews run offline once
+// the providers are cached.
+const localTestSource = `
+variable "greeting" {
+  type = string
+}
+
+variable "BUILD_ID" {
+  type = string
+}
+
+variable "EXPIRATION_DATE" {
+  type    = string
+  default = ""
+}
+
+resource "null_resource" "preview" {
+  triggers = {
+    build_id = var.BUILD_ID
+  }
+}
+
+resource "random_pet" "name" {}
+
+output "greeting" {
+  value = "${var.greeting}, ${random_pet.name.id}"
+}
+
+output "password" {
+  value     = random_pet.name.id
+  sensitive = true
+}
+`
+
+// Returns a configuration for the local builder, skipping the test when
+// neither tofu nor terraform is installed.
+func newLocalTestConfig(t *testing.T) *config.Configuration {
+	t.Helper()
+
+	var binary string
+	for _, name := range []string{"tofu", "terraform"} {
+		if path, err := exec.LookPath(name); err == nil {
+			binary = path
+			break
+		}
+	}
+	if len(binary) == 0 {
+		t.Skip("neither 'tofu' nor 'terraform' found in PATH")
+	}
+
+	source := t.TempDir()
+	dir := filepath.Join(source, "workspaces", "api", "dev", "eastus")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(localTestSource), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &config.Configuration{List: map[string]config.KeyValue{}}
+	set(c, "LOCAL_BINARY", binary)
+	set(c, "LOCAL_SOURCE", source)
+	set(c, "LOCAL_STATE_DIR", t.TempDir())
+	return c
+}
+
+func TestLocalBuildAppliesAndDestroys(t *testing.T) {
+
+	c := newLocalTestConfig(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "tfvar:greeting", "hello")
+
+	ctx := context.Background()
+	director := NewDirector(newLocalIacBuilder())
+
+	var err error
+	captureStdout(t, func() {
+		if _, err = director.Build(ctx, c); err == nil {
+			err = director.Run(ctx)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := director.RunOutputs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]Output)
+	for _, o := range outputs {
+		values[o.Name] = o
+	}
+	if greeting := values["greeting"].String(); !strings.HasPrefix(greeting, "hello, ") {
+		t.Errorf("greeting = %q, want the tfvar applied", greeting)
+	}
+	if password := values["password"]; !password.Sensitive || len(password.String()) == 0 {
+		t.Errorf("password = %+v, want a sensitive value", password)
+	}
+
+	var status Status
+	captureStdout(t, func() { status, err = director.RunStatus(ctx) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ResourceCount != 2 || status.Run == nil || status.Run.Status != "applied" {
+		t.Errorf("status = %+v, want 2 resources and an applied run", status)
+	}
+
+	// Destroy by name, as preview stop does
+	stop := &config.Configuration{List: map[string]config.KeyValue{}}
+	for _, key := range []string{"LOCAL_BINARY", "LOCAL_SOURCE", "LOCAL_STATE_DIR"} {
+		stop.List[key] = c.List[key]
+	}
+	set(stop, "TFC_WORKSPACE", name)
+
+	captureStdout(t, func() { err = NewDirector(newLocalIacBuilder()).Dismantle(ctx, stop) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c.List["LOCAL_STATE_DIR"].Value, name)); !os.IsNotExist(err) {
+		t.Errorf("workspace directory was not removed: %v", err)
+	}
+}
+
+func TestLocalFindWorkspaceRejectsPaths(t *testing.T) {
+
+	// Lookups fail before the binary is ever run
+	c := &config.Configuration{List: map[string]config.KeyValue{}}
+	set(c, "LOCAL_BINARY", "terraform")
+	set(c, "LOCAL_STATE_DIR", t.TempDir())
+
+	for _, target := range []string{"..", "../other", "api/../../etc", "nested/name", `nested\name`} {
+		set(c, "TFC_WORKSPACE", target)
+		var err error
+		captureStdout(t, func() { err = newLocalIacBuilder().findWorkspace(context.Background(), c) })
+		if err == nil || !strings.Contains(err.Error(), "invalid workspace name") {
+			t.Errorf("%s: err = %v, want the name rejected", target, err)
+		}
+	}
+}
+
+// Builds run no binary, so these tests use a placeholder for it.
+func newLocalBuildConfig(t *testing.T) *config.Configuration {
+	t.Helper()
+
+	c := &config.Configuration{List: map[string]config.KeyValue{}}
+	set(c, "LOCAL_BINARY", "terraform")
+	set(c, "LOCAL_SOURCE", t.TempDir())
+	set(c, "LOCAL_STATE_DIR", filepath.Join(t.TempDir(), "previews"))
+	return c
+}
+
+func TestLocalBuildRejectsPathNames(t *testing.T) {
+
+	c := newLocalBuildConfig(t)
+	setPreview(c, time.Now().Add(time.Hour))
+	set(c, "TFC_WORKSPACE_TEMPLATE", "../{{.Service}}-{{.Key}}")
+
+	var err error
+	captureStdout(t, func() { _, err = NewDirector(newLocalIacBuilder()).Build(context.Background(), c) })
+	if err == nil || !strings.Contains(err.Error(), "invalid workspace name") {
+		t.Fatalf("err = %v, want the rendered name rejected", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(c.List["LOCAL_STATE_DIR"].Value)); len(entries) != 0 {
+		t.Errorf("wrote %d entries outside LOCAL_STATE_DIR", len(entries))
+	}
+}
+
+func TestLocalBuildKeepsExpirationWithoutTTL(t *testing.T) {
+
+	c := newLocalBuildConfig(t)
+	expiration := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	setPreview(c, expiration)
+
+	var err error
+	captureStdout(t, func() { _, err = NewDirector(newLocalIacBuilder()).Build(context.Background(), c) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Started again without --ttl
+	delete(c.List, "EXPIRATION_DATE")
+	b := newLocalIacBuilder()
+	captureStdout(t, func() { _, err = NewDirector(b).Build(context.Background(), c) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := expirationVariable(expiration)
+	if got := b.self.Variables[v.id()].Value; got != v.Value {
+		t.Errorf("EXPIRATION_DATE = %q, want %q from the expiration tag", got, v.Value)
+	}
+}
@@ -3,35 +3,58 @@ package iac
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	ci "main/interfaces/ci"
 	config "main/interfaces/configuration"
 	"math/rand"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/go-tfe"
 )
 
-const letterBytes = "0123456789ABCDEF"
+const (
+	letterBytes = "0123456789ABCDEF"
+
+	// Defaults for where previews are hosted in Terraform Cloud
+	DefaultOrganization = "my-org"
+	PreviewProject      = "preview"
+
+	// Terraform Cloud, unless TFC_HOSTNAME points at Terraform Enterprise
+	DefaultHostname = "app.terraform.io"
+
+	// Defaults for Azure dynamic provider credentials
+	DefaultAzureAudience = "api://AzureADTokenExchange"
+)
 
 type TfcIacBuilder struct {
-	Workspace      Iac
-	config         *config.Configuration
-	tfc_api_token  string
-	org            string
-	service        string
-	environment    string
-	location       string
-	build_id       string
-	self           *tfe.Workspace
-	client         *tfe.Client
-	ctx            context.Context
-	project        *tfe.Project
-	oauth_token_id string
+	Workspace        Iac
+	config           *config.Configuration
+	tfc_api_token    string
+	org              string
+	service          string
+	environment      string
+	location         string
+	build_id         string
+	self             *tfe.Workspace
+	client           *tfe.Client
+	project          *tfe.Project
+	hostname         string
+	oauth_token_id   string
+	max_monthly_cost float64
+	run              *tfe.Run
+	poll_interval    time.Duration
 }
 
 // Diagnostic represents a diagnostic type message from Terraform, which is how errors
@@ -78,10 +101,94 @@ func BoolPointer(b bool) *bool {
 }
 
 func newTfcIacBuilder() *TfcIacBuilder {
-	return &TfcIacBuilder{}
+	return &TfcIacBuilder{
+		poll_interval: 10 * time.Second,
+	}
 }
 
 // Helper Functions
+func Organization(c *config.Configuration) string {
+	if org := c.List["TFC_ORGANIZATION"].Value; len(org) != 0 {
+		return org
+	}
+	return DefaultOrganization
+}
+
+func Hostname(c *config.Configuration) string {
+	if hostname := c.List["TFC_HOSTNAME"].Value; len(hostname) != 0 {
+		return strings.TrimSuffix(strings.TrimPrefix(hostname, "https://"), "/")
+	}
+	return DefaultHostname
+}
+
+// Returns an HTTP client trusting the system roots and the PEM encoded
+// certificates in TFC_CA_BUNDLE.
+func getHTTPClient(c *config.Configuration) (*http.Client, error) {
+
+	bundle := c.List["TFC_CA_BUNDLE"].Value
+	if len(bundle) == 0 {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle '%s'", bundle)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// DynamicCredentials reports whether workspaces authenticate to Azure with
+// TFC dynamic provider credentials instead of a client secret.
+func DynamicCredentials(c *config.Configuration) bool {
+	enabled, _ := strconv.ParseBool(c.List["TFC_AZURE_PROVIDER_AUTH"].Value)
+	return enabled
+}
+
+// Replaces the client secret with the variables TFC needs to exchange a
+// workload identity token for an Azure access token.
+func setDynamicCredentials(b *TfcIacBuilder, varmap map[string]Variable) error {
+
+	client_id := b.config.List["TFC_AZURE_RUN_CLIENT_ID"].Value
+	if len(client_id) == 0 {
+		client_id = b.config.List["ARM_CLIENT_ID"].Value
+	}
+	if len(client_id) == 0 {
+		return errors.New("TFC_AZURE_RUN_CLIENT_ID is required when TFC_AZURE_PROVIDER_AUTH is enabled")
+	}
+
+	for id, v := range varmap {
+		if v.Category == CategoryEnv && (v.Key == "ARM_CLIENT_SECRET" || v.Key == "ARM_CLIENT_ID") {
+			delete(varmap, id)
+		}
+	}
+
+	managed := []Variable{
+		{Key: "TFC_AZURE_PROVIDER_AUTH", Value: "true", Category: CategoryEnv},
+		{Key: "TFC_AZURE_RUN_CLIENT_ID", Value: client_id, Category: CategoryEnv},
+	}
+	if audience := b.config.List["TFC_AZURE_WORKLOAD_IDENTITY_AUDIENCE"].Value; len(audience) != 0 {
+		managed = append(managed, Variable{Key: "TFC_AZURE_WORKLOAD_IDENTITY_AUDIENCE", Value: audience, Category: CategoryEnv})
+	}
+	for _, v := range managed {
+		varmap[v.id()] = v
+	}
+
+	ci.Info("Using dynamic provider credentials for Azure")
+	return nil
+}
+
 func RandStringBytes(n int) string {
 	b := make([]byte, n)
 	for i := range b {
@@ -90,50 +197,76 @@ func RandStringBytes(n int) string {
 	return string(b)
 }
 
-func setClient(b *TfcIacBuilder) {
+func setClient(b *TfcIacBuilder) error {
+
+	b.hostname = Hostname(b.config)
+
+	httpClient, err := getHTTPClient(b.config)
+	if err != nil {
+		return err
+	}
 
 	config := &tfe.Config{
+		Address:           "https://" + b.hostname,
 		Token:             b.tfc_api_token,
+		HTTPClient:        httpClient,
 		RetryServerErrors: true,
 	}
 
 	client, err := tfe.NewClient(config)
 	if err != nil {
-		log.Fatal("Failed to initialize client: ", err)
+		return fmt.Errorf("failed to initialize client: %w", err)
 	}
 
-	ctx := context.Background()
-
-	b.ctx = ctx
 	b.client = client
-	fmt.Print("##[info] Logged into Terraform Cloud\n")
+	ci.Info("Logged into '%s'", b.hostname)
+	return nil
 }
 
-func getProjectPreview(b *TfcIacBuilder) {
+func getProjectPreview(ctx context.Context, b *TfcIacBuilder) error {
 
 	// Check project exists
-	pl, pl_err := b.client.Projects.List(b.ctx, b.org, &tfe.ProjectListOptions{
-		Name: "preview",
+	pl, pl_err := b.client.Projects.List(ctx, b.org, &tfe.ProjectListOptions{
+		Name: PreviewProject,
 	})
 
 	if pl_err != nil {
-		log.Fatal(pl_err)
+		return pl_err
 	}
 
 	if pl.TotalCount == 0 {
-		log.Fatal("Project not found.")
-	} else {
-		b.project = pl.Items[0]
+		return fmt.Errorf("project '%s' not found", PreviewProject)
+	}
+	b.project = pl.Items[0]
+	return nil
+}
+
+// Logs into Terraform Cloud and looks up the preview project.
+func connect(ctx context.Context, b *TfcIacBuilder, config *config.Configuration) error {
+
+	// Set Org
+	b.org = Organization(config)
+
+	// Set Config
+	b.config = config
+	b.tfc_api_token = b.config.List["TFC_API_TOKEN"].Value
+
+	// Log into Terraform Cloud
+	if err := setClient(b); err != nil {
+		return err
 	}
+
+	// Previews are only ever looked up in the preview project
+	return getProjectPreview(ctx, b)
 }
 
 func setOAuthToken(b *TfcIacBuilder) {
 
 	b.oauth_token_id = b.config.List["TFC_OAUTH_TOKEN_ID"].Value
 	// fmt.Print("##[info] Lookup OAuth Token\n")
-	// o, err := b.client.OAuthTokens.List(b.ctx, b.org, &tfe.OAuthTokenListOptions{})
+	// o, err := b.client.OAuthTokens.List(ctx, b.org, &tfe.OAuthTokenListOptions{})
 	// if err != nil {
-	// 	log.Fatal(err)
+	// 	return err
 	// }
 	// b.oauth_token = o.Items[0]
 	// fmt.Print("##[info] OAuth Token '" + b.oauth_token.ID + "' returned\n")
@@ -146,93 +279,625 @@ func logErrorsOnly(reader io.Reader) {
 		err := json.Unmarshal([]byte(scanner.Text()), &jsonLog)
 		// It's possible this log is not encoded as JSON at all, so errors will be ignored.
 		if err == nil && jsonLog.Level == "error" {
-			fmt.Println()
-			fmt.Println("--- Error Message")
-			fmt.Println(jsonLog.Message)
-			fmt.Println("---")
-			fmt.Println()
-			if jsonLog.Type == "diagnostic" {
-				fmt.Println("--- Diagnostic Details")
-				fmt.Println(jsonLog.Diagnostic.Detail)
-				fmt.Println("---")
-				fmt.Println()
+			// Reporters add their own error prefix
+			ci.Error("%s", strings.TrimPrefix(jsonLog.Message, "Error: "))
+			if jsonLog.Type == "diagnostic" && len(jsonLog.Diagnostic.Detail) != 0 {
+				ci.Info("%s", jsonLog.Diagnostic.Detail)
 			}
 		}
 	}
 }
 
-func logRunErrors(ctx context.Context, client *tfe.Client, run *tfe.Run) {
+func logRunErrors(ctx context.Context, client *tfe.Client, run *tfe.Run) error {
 	var reader io.Reader
 	var err error
 
 	if run.Apply != nil && run.Apply.Status == tfe.ApplyErrored {
-		log.Printf("Reading apply logs from %q", run.Apply.LogReadURL)
+		ci.Info("Reading apply logs of run '%s'", run.ID)
 		reader, err = client.Applies.Logs(ctx, run.Apply.ID)
 	} else if run.Plan != nil && run.Plan.Status == tfe.PlanErrored {
-		log.Printf("Reading apply logs from %q", run.Plan.LogReadURL)
+		ci.Info("Reading plan logs of run '%s'", run.ID)
 		reader, err = client.Plans.Logs(ctx, run.Plan.ID)
 	} else {
-		log.Fatal("Failed to find an errored plan or apply.")
+		return errors.New("failed to find an errored plan or apply")
 	}
 
 	if err != nil {
-		log.Fatal("Failed to read error log: ", err)
+		return fmt.Errorf("failed to read error log: %w", err)
 	}
 
 	logErrorsOnly(reader)
+	return nil
 }
 
-func readRun(ctx context.Context, client *tfe.Client, id string) *tfe.Run {
+func readRun(ctx context.Context, client *tfe.Client, id string) (*tfe.Run, error) {
 	r, err := client.Runs.ReadWithOptions(ctx, id, &tfe.RunReadOptions{
-		Include: []tfe.RunIncludeOpt{tfe.RunApply, tfe.RunPlan},
+		Include: []tfe.RunIncludeOpt{tfe.RunApply, tfe.RunPlan, tfe.RunCostEstimate},
 	})
 	if err != nil {
-		log.Fatal("Failed to read specified run: ", err)
+		return nil, fmt.Errorf("failed to read run '%s': %w", id, err)
 	}
-	return r
+	return r, nil
 }
 
-// Core Builder Functions
-func (b *TfcIacBuilder) findWorkspace(config *config.Configuration) {
+func setMaxMonthlyCost(b *TfcIacBuilder) error {
 
-	// Set Org
-	b.org = "my-org"
+	value := b.config.List["MAX_MONTHLY_COST"].Value
+	if len(value) == 0 {
+		return nil
+	}
 
-	// Set Config
-	b.config = config
+	cost, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid MAX_MONTHLY_COST '%s': %w", value, err)
+	}
+	if cost <= 0 {
+		return fmt.Errorf("invalid MAX_MONTHLY_COST '%s': must be greater than 0", value)
+	}
+	b.max_monthly_cost = cost
+	return nil
+}
 
-	// Set Additiaonl Variables
-	b.tfc_api_token = b.config.List["TFC_API_TOKEN"].Value
-	b.Workspace.name = b.config.List["TFC_WORKSPACE"].Value
+// Cost estimates are only attached to a run when the organization has cost
+// estimation enabled, so a missing or unfinished estimate returns false.
+func readCostEstimate(run *tfe.Run) (*tfe.CostEstimate, bool) {
+	if run.CostEstimate == nil || run.CostEstimate.Status != tfe.CostEstimateFinished {
+		return nil, false
+	}
+	return run.CostEstimate, true
+}
 
-	// Log into Terraform Cloud
-	setClient(b)
+func costEstimatePending(run *tfe.Run) bool {
+	return run.CostEstimate != nil && (run.CostEstimate.Status == tfe.CostEstimatePending || run.CostEstimate.Status == tfe.CostEstimateQueued)
+}
 
-	// Find Workspace
-	fmt.Print("##[info] Lookup '" + b.Workspace.name + "' workspace\n")
-	wl, wl_err := b.client.Workspaces.List(b.ctx, b.org, &tfe.WorkspaceListOptions{
-		Search: b.Workspace.name,
+func parseCost(value string) float64 {
+	cost, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return cost
+}
+
+func logCostEstimate(ce *tfe.CostEstimate) {
+	ci.Info("Estimated Monthly Cost: $%.2f (prior $%.2f, delta %+.2f)",
+		parseCost(ce.ProposedMonthlyCost),
+		parseCost(ce.PriorMonthlyCost),
+		parseCost(ce.DeltaMonthlyCost),
+	)
+}
+
+// Applies a confirmable run, or discards it when the proposed monthly cost
+// exceeds the configured maximum. Without a finished cost estimate the cost
+// cannot be checked, so the run is discarded too.
+func confirmRun(ctx context.Context, b *TfcIacBuilder, run *tfe.Run) error {
+
+	var reason string
+	ce, ok := readCostEstimate(run)
+	if !ok {
+		reason = fmt.Sprintf("No finished cost estimate to check against the maximum of $%.2f", b.max_monthly_cost)
+	} else if proposed := parseCost(ce.ProposedMonthlyCost); proposed > b.max_monthly_cost {
+		logCostEstimate(ce)
+		reason = fmt.Sprintf("Estimated monthly cost $%.2f exceeds maximum of $%.2f", proposed, b.max_monthly_cost)
+	}
+
+	if len(reason) != 0 {
+		err := b.client.Runs.Discard(ctx, run.ID, tfe.RunDiscardOptions{
+			Comment: tfe.String(reason),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to discard run: %w", err)
+		}
+		return fmt.Errorf("run discarded. %s", reason)
+	}
+
+	err := b.client.Runs.Apply(ctx, run.ID, tfe.RunApplyOptions{
+		Comment: tfe.String("Approved via SDK"),
 	})
+	if err != nil {
+		return fmt.Errorf("failed to apply run: %w", err)
+	}
+	ci.Info("Run Confirmed!")
+	return nil
+}
+
+func listVariables(ctx context.Context, b *TfcIacBuilder) ([]*tfe.Variable, error) {
+
+	var variables []*tfe.Variable
+	options := &tfe.VariableListOptions{
+		ListOptions: tfe.ListOptions{PageSize: 100},
+	}
 
-	if wl_err != nil {
-		log.Fatal(wl_err)
+	for {
+		vl, err := b.client.Variables.List(ctx, b.self.ID, options)
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, vl.Items...)
+		if vl.Pagination == nil || vl.Pagination.NextPage == 0 {
+			return variables, nil
+		}
+		options.PageNumber = vl.Pagination.NextPage
 	}
+}
+
+func attachVariableSets(ctx context.Context, b *TfcIacBuilder, names []string) error {
 
-	fmt.Printf("##[info] Found '%d' Workspace(s)\n", wl.TotalCount)
-	if wl.TotalCount > 1 {
-		log.Fatalf("Error: Expected 1 Workspace. Received '%d' matches. Exiting Script.", wl.TotalCount)
-	} else if wl.TotalCount == 1 {
-		b.self = wl.Items[0]
-		fmt.Print("##[info] Workspace '" + b.self.Name + "' exists\n")
+	if len(names) == 0 {
+		return nil
+	}
+
+	sets := make(map[string]*tfe.VariableSet)
+	options := &tfe.VariableSetListOptions{
+		ListOptions: tfe.ListOptions{PageSize: 100},
+	}
+
+	for {
+		vl, err := b.client.VariableSets.List(ctx, b.org, options)
+		if err != nil {
+			return err
+		}
+		for _, vs := range vl.Items {
+			sets[vs.Name] = vs
+		}
+		if vl.Pagination == nil || vl.Pagination.NextPage == 0 {
+			break
+		}
+		options.PageNumber = vl.Pagination.NextPage
+	}
+
+	for _, name := range names {
+		vs, ok := sets[name]
+		if !ok {
+			return fmt.Errorf("variable set '%s' not found", name)
+		}
+		if vs.Global {
+			ci.Info("Variable Set '%s' is global. Skipping.", name)
+			continue
+		}
+		err := b.client.VariableSets.ApplyToWorkspaces(ctx, vs.ID, &tfe.VariableSetApplyToWorkspacesOptions{
+			Workspaces: []*tfe.Workspace{b.self},
+		})
+		if err != nil {
+			return err
+		}
+		ci.Info("Attached Variable Set '%s'", name)
+	}
+
+	return nil
+}
+
+func expirationVariable(expiration time.Time) Variable {
+	return Variable{
+		Key:      "EXPIRATION_DATE",
+		Value:    strconv.FormatInt(expiration.Unix(), 10),
+		Category: CategoryTerraform,
+	}
+}
+
+// Attaches notification configurations to the workspace so Terraform Cloud
+// reports on its runs.
+func attachNotifications(ctx context.Context, b *TfcIacBuilder, notifications []Notification) error {
+
+	for _, n := range notifications {
+		triggers := make([]tfe.NotificationTriggerType, len(n.Triggers))
+		for i, trigger := range n.Triggers {
+			triggers[i] = tfe.NotificationTriggerType(trigger)
+		}
+
+		options := tfe.NotificationConfigurationCreateOptions{
+			DestinationType: tfe.NotificationDestination(tfe.NotificationDestinationType(n.Type)),
+			Enabled:         tfe.Bool(true),
+			Name:            tfe.String(n.Name),
+			Triggers:        triggers,
+			URL:             tfe.String(n.URL),
+		}
+		if len(n.Token) != 0 {
+			options.Token = tfe.String(n.Token)
+		}
+
+		if _, err := b.client.NotificationConfigurations.Create(ctx, b.self.ID, options); err != nil {
+			return fmt.Errorf("failed to attach notification '%s': %w", n.Name, err)
+		}
+		ci.Info("Notification '%s' attached", n.Name)
+	}
+	return nil
+}
+
+// Replaces any existing expiration tag on the workspace.
+func setExpirationTag(ctx context.Context, b *TfcIacBuilder, expiration time.Time) error {
+
+	var stale []*tfe.Tag
+	for _, tag := range b.self.TagNames {
+		if strings.HasPrefix(tag, ExpirationTagPrefix) {
+			stale = append(stale, &tfe.Tag{Name: tag})
+		}
+	}
+
+	if len(stale) != 0 {
+		err := b.client.Workspaces.RemoveTags(ctx, b.self.ID, tfe.WorkspaceRemoveTagsOptions{
+			Tags: stale,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := b.client.Workspaces.AddTags(ctx, b.self.ID, tfe.WorkspaceAddTagsOptions{
+		Tags: []*tfe.Tag{{Name: ExpirationTag(expiration)}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ci.Info("Workspace expires at '%s'", expiration.Format(time.RFC3339))
+	return nil
+}
+
+// Creates or updates a single workspace variable.
+func upsertVariable(ctx context.Context, b *TfcIacBuilder, v Variable) error {
+
+	variables, err := listVariables(ctx, b)
+	if err != nil {
+		return err
+	}
+
+	for _, current := range variables {
+		if string(current.Category) == v.Category && current.Key == v.Key {
+			_, err := b.client.Variables.Update(ctx, b.self.ID, current.ID, tfe.VariableUpdateOptions{
+				Value:       tfe.String(v.Value),
+				Description: tfe.String(ManagedVariableDescription),
+				HCL:         tfe.Bool(v.HCL),
+				Sensitive:   tfe.Bool(v.Sensitive),
+			})
+			return err
+		}
+	}
+
+	_, err = b.client.Variables.Create(ctx, b.self.ID, tfe.VariableCreateOptions{
+		Key:         tfe.String(v.Key),
+		Value:       tfe.String(v.Value),
+		Description: tfe.String(ManagedVariableDescription),
+		Category:    tfe.Category(tfe.CategoryType(v.Category)),
+		HCL:         tfe.Bool(v.HCL),
+		Sensitive:   tfe.Bool(v.Sensitive),
+	})
+	return err
+}
+
+func commentOrNil(comment string) *string {
+	if len(comment) == 0 {
+		return nil
+	}
+	return tfe.String(comment)
+}
+
+func workspaceURL(b *TfcIacBuilder) string {
+	return fmt.Sprintf("https://%s/app/%s/workspaces/%s", b.hostname, b.org, b.self.Name)
+}
+
+func runURL(b *TfcIacBuilder, id string) string {
+	return workspaceURL(b) + "/runs/" + id
+}
+
+// Returns how long a run took, or has taken so far when still in progress.
+func runDuration(r *tfe.Run) time.Duration {
+	end := time.Now()
+	if ts := r.StatusTimestamps; ts != nil {
+		for _, t := range []time.Time{ts.AppliedAt, ts.PlannedAndFinishedAt, ts.ErroredAt, ts.CanceledAt, ts.ForceCanceledAt, ts.DiscardedAt} {
+			if !t.IsZero() {
+				end = t
+				break
+			}
+		}
+	}
+	return end.Sub(r.CreatedAt).Round(time.Second)
+}
+
+// Reports whether stdin is a terminal that can be prompted. Tests replace it.
+var isInteractive = func() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Asks whether to cancel the in-flight run. Without a terminal to ask, the
+// run is canceled. Declining, or a second interrupt while prompting, leaves
+// the run running and returns ErrInterrupted.
+func handleInterrupt(ctx context.Context, b *TfcIacBuilder, r *tfe.Run, interrupt chan os.Signal) error {
+
+	fmt.Println()
+	if isInteractive() {
+		answer := make(chan string, 1)
+		go func() {
+			fmt.Printf("Cancel run '%s'? [y/N] ", r.ID)
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			answer <- strings.ToLower(strings.TrimSpace(line))
+		}()
+
+		select {
+		case a := <-answer:
+			if a != "y" && a != "yes" {
+				ci.Warning("Run left running: %s", runURL(b, r.ID))
+				return ErrInterrupted
+			}
+		case <-interrupt:
+			fmt.Println()
+			ci.Warning("Run left running: %s", runURL(b, r.ID))
+			return ErrInterrupted
+		}
+	}
+
+	return cancelInFlight(ctx, b, r)
+}
+
+func cancelInFlight(ctx context.Context, b *TfcIacBuilder, r *tfe.Run) error {
+
+	err := b.client.Runs.Cancel(ctx, r.ID, tfe.RunCancelOptions{
+		Comment: tfe.String("Interrupted via SDK"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel run: %w", err)
+	}
+	ci.Info("Cancel requested for run '%s'", r.ID)
+	return nil
+}
+
+// Core Builder Functions
+func (b *TfcIacBuilder) findWorkspace(ctx context.Context, config *config.Configuration) error {
+
+	if err := connect(ctx, b, config); err != nil {
+		return err
+	}
+
+	target := b.config.List["TFC_WORKSPACE"].Value
+	tags := SelectorTags(b.config)
+
+	// Exact Name or ID
+	if len(target) != 0 {
+		ci.Info("Lookup '%s' workspace", target)
+		ws, err := readWorkspace(ctx, b, target)
+		if err == nil {
+			return b.useWorkspace(ws)
+		} else if err != tfe.ErrResourceNotFound {
+			return err
+		} else if len(tags) == 0 {
+			return fmt.Errorf("workspace '%s' not found", target)
+		}
+		ci.Info("Workspace '%s' not found. Searching by tags.", target)
+	}
+
+	if len(tags) == 0 {
+		return errors.New("a workspace name, ID or selector is required")
+	}
+
+	// Tags
+	ci.Info("Lookup workspaces tagged '%s'", strings.Join(tags, ", "))
+	var candidates []*tfe.Workspace
+	options := &tfe.WorkspaceListOptions{
+		ListOptions: tfe.ListOptions{PageSize: 100},
+		ProjectID:   b.project.ID,
+		Tags:        strings.Join(tags, ","),
+	}
+	for {
+		wl, err := b.client.Workspaces.List(ctx, b.org, options)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, wl.Items...)
+		if wl.Pagination == nil || wl.Pagination.NextPage == 0 {
+			break
+		}
+		options.PageNumber = wl.Pagination.NextPage
+	}
+
+	ci.Info("Found '%d' Workspace(s)", len(candidates))
+	if len(candidates) == 0 {
+		return fmt.Errorf("no workspace tagged '%s'", strings.Join(tags, ", "))
+	}
+
+	names := make([]string, len(candidates))
+	for i, ws := range candidates {
+		names[i] = ws.Name
+	}
+	name, err := chooseWorkspace(names)
+	if err != nil {
+		return err
+	}
+	return b.useWorkspace(candidates[slices.Index(names, name)])
+}
+
+// Reads a workspace of the preview project by its ID or exact name.
+func readWorkspace(ctx context.Context, b *TfcIacBuilder, target string) (*tfe.Workspace, error) {
+
+	var (
+		ws  *tfe.Workspace
+		err error
+	)
+	if strings.HasPrefix(target, "ws-") {
+		ws, err = b.client.Workspaces.ReadByID(ctx, target)
 	} else {
-		log.Fatalf("##[info] Workspace '" + b.self.Name + "' not found.\n")
+		ws, err = b.client.Workspaces.Read(ctx, b.org, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ws.Project == nil || ws.Project.ID != b.project.ID {
+		return nil, fmt.Errorf("workspace '%s' is not in the '%s' project", ws.Name, b.project.Name)
+	}
+	return ws, nil
+}
+
+func (b *TfcIacBuilder) useWorkspace(ws *tfe.Workspace) error {
+	b.self = ws
+	b.Workspace.name = ws.Name
+	b.Workspace.tags = ws.TagNames
+	ci.Info("Workspace '%s' exists", b.self.Name)
+	return nil
+}
+
+func (b *TfcIacBuilder) findRun(ctx context.Context, config *config.Configuration) error {
+
+	run_id := config.List["TFC_RUN"].Value
+	if len(run_id) == 0 {
+		if err := b.findWorkspace(ctx, config); err != nil {
+			return err
+		}
+		if b.self.CurrentRun == nil {
+			return fmt.Errorf("workspace '%s' has no runs", b.self.Name)
+		}
+		r, err := readRun(ctx, b.client, b.self.CurrentRun.ID)
+		if err != nil {
+			return err
+		}
+		b.run = r
+		return nil
+	}
+
+	if err := connect(ctx, b, config); err != nil {
+		return err
+	}
+
+	r, err := readRun(ctx, b.client, run_id)
+	if err != nil {
+		return err
+	}
+	b.run = r
+	if b.run.Workspace == nil {
+		return fmt.Errorf("run '%s' has no workspace", run_id)
 	}
+
+	ws, err := b.client.Workspaces.ReadByID(ctx, b.run.Workspace.ID)
+	if err != nil {
+		return err
+	}
+	if ws.Project == nil || ws.Project.ID != b.project.ID {
+		return fmt.Errorf("workspace '%s' is not in the '%s' project", ws.Name, b.project.Name)
+	}
+
+	b.self = ws
+	b.Workspace.name = ws.Name
+	ci.Info("Run '%s' belongs to workspace '%s'", b.run.ID, b.self.Name)
+	return nil
 }
 
-func (b *TfcIacBuilder) createWorkspace(config *config.Configuration) {
+func (b *TfcIacBuilder) cancelRun(ctx context.Context, reason string) error {
+
+	if b.run.Actions == nil || !b.run.Actions.IsCancelable {
+		return fmt.Errorf("run '%s' cannot be canceled while %q", b.run.ID, b.run.Status)
+	}
+
+	err := b.client.Runs.Cancel(ctx, b.run.ID, tfe.RunCancelOptions{
+		Comment: commentOrNil(reason),
+	})
+	if err != nil {
+		return err
+	}
+	ci.Info("Run '%s' canceled", b.run.ID)
+	return nil
+}
+
+func (b *TfcIacBuilder) discardRun(ctx context.Context, reason string) error {
+
+	if b.run.Actions == nil || !b.run.Actions.IsDiscardable {
+		return fmt.Errorf("run '%s' cannot be discarded while %q", b.run.ID, b.run.Status)
+	}
+
+	err := b.client.Runs.Discard(ctx, b.run.ID, tfe.RunDiscardOptions{
+		Comment: commentOrNil(reason),
+	})
+	if err != nil {
+		return err
+	}
+	ci.Info("Run '%s' discarded", b.run.ID)
+	return nil
+}
+
+func (b *TfcIacBuilder) lockWorkspace(ctx context.Context, reason string) error {
+
+	_, err := b.client.Workspaces.Lock(ctx, b.self.ID, tfe.WorkspaceLockOptions{
+		Reason: commentOrNil(reason),
+	})
+	if err != nil {
+		return err
+	}
+	ci.Info("Workspace '%s' locked", b.self.Name)
+	return nil
+}
+
+func (b *TfcIacBuilder) unlockWorkspace(ctx context.Context) error {
+
+	_, err := b.client.Workspaces.Unlock(ctx, b.self.ID)
+	if err != nil {
+		return err
+	}
+	ci.Info("Workspace '%s' unlocked", b.self.Name)
+	return nil
+}
+
+func (b *TfcIacBuilder) listWorkspaces(ctx context.Context, config *config.Configuration) ([]Preview, error) {
+
+	if err := connect(ctx, b, config); err != nil {
+		return nil, err
+	}
+	return listPreviews(ctx, b)
+}
+
+// Looks the workspace up across the organization, as workspaces moved out of
+// the preview project still own their Azure resources.
+func (b *TfcIacBuilder) workspaceExists(ctx context.Context, name string) (bool, error) {
+
+	_, err := b.client.Workspaces.Read(ctx, b.org, name)
+	if err == tfe.ErrResourceNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read workspace '%s': %w", name, err)
+	}
+	return true, nil
+}
+
+// Returns every workspace in the preview project.
+func listPreviews(ctx context.Context, b *TfcIacBuilder) ([]Preview, error) {
+
+	var previews []Preview
+	options := &tfe.WorkspaceListOptions{
+		ListOptions: tfe.ListOptions{PageSize: 100},
+		ProjectID:   b.project.ID,
+		Include:     []tfe.WSIncludeOpt{tfe.WSCurrentRun},
+	}
+
+	for {
+		wl, err := b.client.Workspaces.List(ctx, b.org, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, ws := range wl.Items {
+			preview := Preview{
+				Name:          ws.Name,
+				ID:            ws.ID,
+				Tags:          ws.TagNames,
+				CreatedAt:     ws.CreatedAt,
+				ResourceCount: ws.ResourceCount,
+			}
+			if ws.CurrentRun != nil {
+				preview.RunStatus = string(ws.CurrentRun.Status)
+			}
+			if expiration, ok := ParseExpirationTags(ws.TagNames); ok {
+				preview.Expiration = expiration
+			}
+			previews = append(previews, preview)
+		}
+		if wl.Pagination == nil || wl.Pagination.NextPage == 0 {
+			return previews, nil
+		}
+		options.PageNumber = wl.Pagination.NextPage
+	}
+}
+
+func (b *TfcIacBuilder) createWorkspace(ctx context.Context, config *config.Configuration) error {
 
 	// Set Org
-	b.org = "my-org"
+	b.org = Organization(config)
 
 	// Set Config
 	b.config = config
@@ -242,46 +907,94 @@ func (b *TfcIacBuilder) createWorkspace(config *config.Configuration) {
 	b.service = b.config.List["SERVICE"].Value
 	b.environment = b.config.List["ENVIRONMENT"].Value
 	b.location = b.config.List["LOCATION"].Value
-	b.build_id = RandStringBytes(4)
-	b.Workspace.name = b.service + "-" + b.build_id + "-" + b.environment + "-" + b.location
+
+	// Derive Workspace Name
+	key := GetWorkspaceKey(b.config)
+	if key.IsDeterministic() {
+		b.build_id = key.ID()
+	} else {
+		ci.Warning("No branch or pull request provided. Generating a random workspace name.")
+		b.build_id = RandStringBytes(4)
+	}
+
+	name, err := key.Name(b.config.List["TFC_WORKSPACE_TEMPLATE"].Value, b.build_id)
+	if err != nil {
+		return fmt.Errorf("failed to render workspace name: %w", err)
+	}
+	b.Workspace.name = name
 	b.Workspace.working_directory = "workspaces/" + b.service + "/" + b.environment + "/" + b.location
 
 	// Log into Terraform Cloud
-	setClient(b)
+	if err := setClient(b); err != nil {
+		return err
+	}
 
-	// Find Workspace
-	// fmt.Print("##[info] Lookup '" + b.Workspace.name + "' workspace\n")
-	// wl, wl_err := b.client.Workspaces.List(b.ctx, b.org, &tfe.WorkspaceListOptions{
-	// 	Search: b.Workspace.name,
-	// })
+	// Preqreuisites
+	if err := getProjectPreview(ctx, b); err != nil {
+		return err
+	}
+	setOAuthToken(b)
+	if err := setMaxMonthlyCost(b); err != nil {
+		return err
+	}
+	notifications, err := getNotifications(b.config)
+	if err != nil {
+		return err
+	}
 
-	// if wl_err != nil {
-	// 	log.Fatal(wl_err)
-	// }
+	// Reuse Existing Workspace
+	ci.Info("Lookup '%s' workspace", b.Workspace.name)
+	wr, err := b.client.Workspaces.Read(ctx, b.org, b.Workspace.name)
+	if err == nil {
+		if wr.Project == nil || wr.Project.ID != b.project.ID {
+			return fmt.Errorf("workspace '%s' exists outside of the '%s' project", wr.Name, b.project.Name)
+		}
+		b.self = wr
+		ci.Info("Workspace '%s' exists. Queuing a new run.", b.self.Name)
+		if expiration, ok := GetExpiration(b.config); ok {
+			return setExpirationTag(ctx, b, expiration)
+		}
+		return nil
+	} else if err != tfe.ErrResourceNotFound {
+		return err
+	}
 
-	// fmt.Printf("##[info] Found '%d' Workspace(s)\n", wl.TotalCount)
-	// if wl.TotalCount > 1 {
-	// 	log.Fatalf("Error: Expected 1 Workspace. Received '%d' matches. Exiting Script.", wl.TotalCount)
-	// } else if wl.TotalCount == 1 {
-	// 	b.self = wl.Items[0]
-	// 	fmt.Print("##[info] Workspace '" + b.self.Name + "' exists\n")
-	// } else {
+	// Enforce Quotas
+	previews, err := listPreviews(ctx, b)
+	if err != nil {
+		return err
+	}
+	if err := checkQuota(b.config, previews); err != nil {
+		return err
+	}
 
-	// Preqreuisites
-	getProjectPreview(b)
-	setOAuthToken(b)
+	tags := []*tfe.Tag{
+		{Name: b.service},
+	}
+	if len(key.PullRequest) != 0 {
+		tags = append(tags, &tfe.Tag{Name: "pr:" + key.PullRequest})
+	} else if len(key.Branch) != 0 {
+		tags = append(tags, &tfe.Tag{Name: "branch:" + Slugify(key.Branch)})
+	}
+	if len(b.location) != 0 {
+		tags = append(tags, &tfe.Tag{Name: LocationTagPrefix + b.location})
+	}
+	if owner := b.config.List["OWNER"].Value; len(owner) != 0 {
+		tags = append(tags, &tfe.Tag{Name: OwnerTag(owner)})
+	}
+	if expiration, ok := GetExpiration(b.config); ok {
+		tags = append(tags, &tfe.Tag{Name: ExpirationTag(expiration)})
+	}
 
 	// Create a new workspace
-	fmt.Printf("##[info] Creating Workspace in '%s' Project\n", b.project.Name)
-	wc, err := b.client.Workspaces.Create(b.ctx, b.org, tfe.WorkspaceCreateOptions{
+	ci.Info("Creating Workspace in '%s' Project", b.project.Name)
+	wc, err := b.client.Workspaces.Create(ctx, b.org, tfe.WorkspaceCreateOptions{
 		Name:             tfe.String(b.Workspace.name),
 		AllowDestroyPlan: tfe.Bool(true),
 		ExecutionMode:    tfe.String("remote"),
 		WorkingDirectory: tfe.String(b.Workspace.working_directory),
 		Project:          b.project,
-		Tags: []*tfe.Tag{
-			{Name: b.service},
-		},
+		Tags:             tags,
 		VCSRepo: &tfe.VCSRepoOptions{
 			Branch:            tfe.String("main"),
 			Identifier:        tfe.String("Org/Repo"),
@@ -290,165 +1003,353 @@ func (b *TfcIacBuilder) createWorkspace(config *config.Configuration) {
 		},
 	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	b.self = wc
-	fmt.Print("##[info] Workspace '" + b.self.Name + "' created\n")
+	b.Workspace.created = true
+	ci.Info("Workspace '%s' created", b.self.Name)
+
+	return attachNotifications(ctx, b, notifications)
+}
+
+func (b *TfcIacBuilder) extendWorkspace(ctx context.Context, by time.Duration) error {
+
+	service := b.config.List["SERVICE"].Value
+	if len(service) != 0 && !slices.Contains(b.self.TagNames, service) {
+		return fmt.Errorf("workspace '%s' does not belong to service '%s'", b.self.Name, service)
+	}
+
+	// The apply queued after extending is guarded like the one start queues
+	if err := setMaxMonthlyCost(b); err != nil {
+		return err
+	}
+
+	// Extend from the current expiration, or from now when already expired
+	base := time.Now()
+	if current, ok := ParseExpirationTags(b.self.TagNames); ok && current.After(base) {
+		base = current
+	}
+	expiration := base.Add(by)
+
+	if err := CheckExpiration(b.config, expiration); err != nil {
+		return err
+	}
+
+	if err := upsertVariable(ctx, b, expirationVariable(expiration)); err != nil {
+		return err
+	}
+	return setExpirationTag(ctx, b, expiration)
 }
 
-func (b *TfcIacBuilder) deleteWorkspace() {
+func (b *TfcIacBuilder) deleteWorkspace(ctx context.Context) error {
 
 	// Find Workspace
-	err := b.client.Workspaces.Delete(b.ctx, b.org, b.Workspace.name)
+	err := b.client.Workspaces.Delete(ctx, b.org, b.Workspace.name)
 
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	fmt.Println("##[info] Workspace '" + b.Workspace.name + "' deleted.\n")
+	ci.Info("Workspace '%s' deleted.", b.Workspace.name)
+	return nil
 }
 
-func (b *TfcIacBuilder) setVariables() {
+func (b *TfcIacBuilder) setVariables(ctx context.Context) error {
 
-	type Variable struct {
-		Value     string            `json:"value"`
-		Sensitive bool              `json:"sensitive"`
-		Category  *tfe.CategoryType `json:"category"`
+	// Resolve Declared Variables
+	varmap, err := ResolveVariables(b.config)
+	if err != nil {
+		return err
 	}
-
-	// Create VarMap
-	varmap := make(map[string]interface{})
-	varmap["ARM_TENANT_ID"] = Variable{
-		Value:     b.config.List["ARM_TENANT_ID"].Value,
-		Sensitive: false,
-		Category:  tfe.Category("env"),
+	build_id := Variable{
+		Key:      "BUILD_ID",
+		Value:    b.build_id,
+		Category: CategoryTerraform,
 	}
-	varmap["ARM_CLIENT_ID"] = Variable{
-		Value:     b.config.List["ARM_CLIENT_ID"].Value,
-		Sensitive: false,
-		Category:  tfe.Category("env"),
+	varmap[build_id.id()] = build_id
+
+	// Without a new TTL, a reused workspace keeps the expiration of its tag
+	expiration, ok := GetExpiration(b.config)
+	if !ok {
+		expiration, ok = ParseExpirationTags(b.self.TagNames)
 	}
-	varmap["ARM_CLIENT_SECRET"] = Variable{
-		Value:     b.config.List["ARM_CLIENT_SECRET"].Value,
-		Sensitive: true,
-		Category:  tfe.Category("env"),
+	if ok {
+		v := expirationVariable(expiration)
+		varmap[v.id()] = v
 	}
-	varmap["BUILD_ID"] = Variable{
-		Value:     b.build_id,
-		Sensitive: false,
-		Category:  tfe.Category("terraform"),
+
+	if DynamicCredentials(b.config) {
+		if err := setDynamicCredentials(b, varmap); err != nil {
+			return err
+		}
 	}
 
-	vl, err := b.client.Variables.List(b.ctx, b.self.ID, &tfe.VariableListOptions{})
+	// Reconcile Workspace Variables
+	variables, err := listVariables(ctx, b)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	existing := make(map[string]*tfe.Variable)
+	for _, v := range variables {
+		existing[string(v.Category)+"/"+v.Key] = v
+	}
+
+	var current string
+	if v, ok := existing[ownerVariable("").id()]; ok {
+		current = v.Value
+	}
+	if v, ok := getOwnerVariable(b.config.List["OWNER"].Value, current); ok {
+		varmap[v.id()] = v
 	}
 
-	for k := range varmap {
-		_, err := b.client.Variables.Create(b.ctx, b.self.ID, tfe.VariableCreateOptions{
-			Key:       tfe.String(k),
-			Value:     tfe.String(varmap[k].(Variable).Value),
-			Category:  varmap[k].(Variable).Category,
-			Sensitive: tfe.Bool(varmap[k].(Variable).Sensitive),
+	for id, v := range varmap {
+		if current, ok := existing[id]; ok {
+			_, err := b.client.Variables.Update(ctx, b.self.ID, current.ID, tfe.VariableUpdateOptions{
+				Value:       tfe.String(v.Value),
+				Description: tfe.String(ManagedVariableDescription),
+				HCL:         tfe.Bool(v.HCL),
+				Sensitive:   tfe.Bool(v.Sensitive),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update %s variable '%s': %w", v.Category, v.Key, err)
+			}
+			ci.Info("Updated %s variable '%s'", v.Category, v.Key)
+			continue
+		}
+
+		_, err := b.client.Variables.Create(ctx, b.self.ID, tfe.VariableCreateOptions{
+			Key:         tfe.String(v.Key),
+			Value:       tfe.String(v.Value),
+			Description: tfe.String(ManagedVariableDescription),
+			Category:    tfe.Category(tfe.CategoryType(v.Category)),
+			HCL:         tfe.Bool(v.HCL),
+			Sensitive:   tfe.Bool(v.Sensitive),
 		})
 		if err != nil {
-			for _, arr := range vl.Items {
-				if k == arr.Key {
-					// Update Values
-					_, err := b.client.Variables.Update(b.ctx, b.self.ID, arr.ID, tfe.VariableUpdateOptions{
-						Value:     tfe.String(varmap[k].(Variable).Value),
-						Category:  varmap[k].(Variable).Category,
-						Sensitive: tfe.Bool(varmap[k].(Variable).Sensitive),
-					})
-					if err != nil {
-						log.Fatal(err)
-					}
-				}
-			}
+			return fmt.Errorf("failed to create %s variable '%s': %w", v.Category, v.Key, err)
+		}
+		ci.Info("Created %s variable '%s'", v.Category, v.Key)
+	}
+
+	for id, current := range existing {
+		if _, ok := varmap[id]; ok || current.Description != ManagedVariableDescription {
+			continue
+		}
+		if err := b.client.Variables.Delete(ctx, b.self.ID, current.ID); err != nil {
+			return fmt.Errorf("failed to remove %s variable '%s': %w", current.Category, current.Key, err)
 		}
+		ci.Info("Removed %s variable '%s'", current.Category, current.Key)
 	}
+
+	// Attach Variable Sets
+	return attachVariableSets(ctx, b, getVariableSets(b.config))
 }
 
-func (b *TfcIacBuilder) runWorkspace(RunType string) {
+func (b *TfcIacBuilder) runWorkspace(ctx context.Context, RunType string) error {
 
 	var (
-		pollInterval = 10 * time.Second
+		isDestroy = strings.ToLower(RunType) == "destroy"
+		guardrail = !isDestroy && b.max_monthly_cost > 0
 	)
 
-	fmt.Println("[group]Create Workspace Run")
+	ci.Group("Create Workspace Run")
 
-	rc, err := b.client.Runs.Create(b.ctx, tfe.RunCreateOptions{
+	// Runs guarded by a cost threshold are confirmed manually once the
+	// cost estimate is available.
+	rc, err := b.client.Runs.Create(ctx, tfe.RunCreateOptions{
 		Message:   tfe.String("Triggered via SDK"),
 		Workspace: b.self,
-		IsDestroy: tfe.Bool(strings.ToLower(RunType) == "destroy"),
-		AutoApply: tfe.Bool(true),
+		IsDestroy: tfe.Bool(isDestroy),
+		AutoApply: tfe.Bool(!guardrail),
 	})
 
 	if err != nil {
-		log.Fatal("##[error] Failed to read specified run: ", err)
+		ci.EndGroup()
+		return fmt.Errorf("failed to create run: %w", err)
 	}
 
-	r := readRun(b.ctx, b.client, rc.ID)
+	r, err := readRun(ctx, b.client, rc.ID)
+	if err != nil {
+		ci.EndGroup()
+		return err
+	}
+	ci.Info("Run URL: %s", runURL(b, r.ID))
+
+	// Offer to cancel the run rather than leave it running when interrupted
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	b.run = r
+	run_err := b.pollRun(ctx, guardrail, interrupt)
+
+	ci.EndGroup()
+
+	// Run Summary
+	ci.Section("Run '%s' finished with status %q", b.run.ID, b.run.Status)
+	if ce, ok := readCostEstimate(b.run); ok {
+		logCostEstimate(ce)
+	}
+
+	return run_err
+}
+
+// Polls b.run until it reaches a final status, confirming it once when the
+// cost guardrail applies.
+func (b *TfcIacBuilder) pollRun(ctx context.Context, guardrail bool, interrupt chan os.Signal) error {
+
+	confirmed := false
 
-poll:
 	for {
-		<-time.After(pollInterval)
+		select {
+		case <-time.After(b.poll_interval):
+		case <-interrupt:
+			if err := handleInterrupt(ctx, b, b.run, interrupt); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			// Don't leave the run behind when the caller gives up on it
+			if err := cancelInFlight(context.WithoutCancel(ctx), b, b.run); err != nil {
+				return errors.Join(ctx.Err(), err)
+			}
+			return ctx.Err()
+		}
 
-		r := readRun(b.ctx, b.client, r.ID)
+		r, err := readRun(ctx, b.client, b.run.ID)
+		if err != nil {
+			return err
+		}
+		b.run = r
 
 		switch r.Status {
 		case tfe.RunPlannedAndFinished:
-			fmt.Println("##[info] Planned and Finished!")
-			break poll
+			ci.Info("Planned and Finished!")
+			return nil
 		case tfe.RunApplied:
-			fmt.Println("##[info] Run Applied!")
-			break poll
+			ci.Info("Run Applied!")
+			return nil
 		case tfe.RunErrored:
-			fmt.Println("##[error] Run had errors!")
-			logRunErrors(b.ctx, b.client, r)
-			break poll
+			ci.Error("Run had errors!")
+			return errors.Join(fmt.Errorf("run '%s' errored", r.ID), logRunErrors(ctx, b.client, r))
+		case tfe.RunCanceled, tfe.RunDiscarded:
+			return fmt.Errorf("run '%s' %s", r.ID, r.Status)
 		default:
-			fmt.Printf("##[info] Run status %q...\n", r.Status)
+			if guardrail && !confirmed && r.Actions != nil && r.Actions.IsConfirmable && !costEstimatePending(r) {
+				if err := confirmRun(ctx, b, r); err != nil {
+					return err
+				}
+				confirmed = true
+				continue
+			}
+			ci.Info("Run status %q...", r.Status)
 		}
 	}
+}
+
+func (b *TfcIacBuilder) getOutputs(ctx context.Context) ([]Output, error) {
+
+	sv, err := b.client.StateVersionOutputs.ReadCurrent(ctx, b.self.ID)
+	if err == tfe.ErrResourceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read current state version: %w", err)
+	}
 
-	fmt.Println("[endgroup]")
+	var outputs []Output
+	for _, arr := range sv.Items {
+		// Sensitive values are omitted when listing, so read them individually
+		if arr.Sensitive && arr.Value == nil {
+			so, err := b.client.StateVersionOutputs.Read(ctx, arr.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read sensitive output '%s': %w", arr.Name, err)
+			}
+			arr = so
+		}
+		outputs = append(outputs, Output{
+			Name:      arr.Name,
+			Type:      arr.Type,
+			Sensitive: arr.Sensitive,
+			Value:     arr.Value,
+		})
+	}
+
+	return outputs, nil
 }
 
-func (b *TfcIacBuilder) getOutput() {
+func (b *TfcIacBuilder) getOutput(ctx context.Context) error {
 
-	var (
-		default_hostname string
-	)
+	outputs, err := b.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	return printOutputs(b.self.Name, outputs)
+}
 
-	fmt.Println("[group]Terraform Output")
+func (b *TfcIacBuilder) getResourceCount(ctx context.Context) (int, error) {
 
-	sv, err := b.client.StateVersionOutputs.ReadCurrent(b.ctx, b.self.ID)
+	// The count on b.self is as of when the workspace was last read
+	ws, err := b.client.Workspaces.ReadByID(ctx, b.self.ID)
 	if err != nil {
-		log.Fatal("##[error] Failed to read specified state version: ", err)
+		return 0, err
 	}
+	return ws.ResourceCount, nil
+}
 
-	for _, arr := range sv.Items {
-		fmt.Printf("##vso[task.setvariable variable=" + arr.Name + ";isOutput=true]" + arr.Value.(string) + "\n")
-		outJson := map[string]interface{}{
-			"name":  arr.Name,
-			"value": arr.Value,
+func (b *TfcIacBuilder) getStatus(ctx context.Context) (Status, error) {
+
+	// b.self is as of when the workspace was created or found, before any run
+	ws, err := b.client.Workspaces.ReadByIDWithOptions(ctx, b.self.ID, &tfe.WorkspaceReadOptions{
+		Include: []tfe.WSIncludeOpt{tfe.WSCurrentRun},
+	})
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to read workspace '%s': %w", b.self.Name, err)
+	}
+	b.self = ws
+
+	status := Status{
+		Name:          b.self.Name,
+		ID:            b.self.ID,
+		URL:           workspaceURL(b),
+		Branch:        refFromTags(b.self.TagNames),
+		ResourceCount: b.self.ResourceCount,
+		Owner:         tagValue(b.self.TagNames, OwnerTagPrefix),
+		Locked:        b.self.Locked,
+		Outputs:       []Output{},
+	}
+
+	if expiration, ok := ParseExpirationTags(b.self.TagNames); ok {
+		status.Expiration = &expiration
+	}
+
+	if b.self.CurrentRun != nil {
+		r, err := b.client.Runs.ReadWithOptions(ctx, b.self.CurrentRun.ID, &tfe.RunReadOptions{
+			Include: []tfe.RunIncludeOpt{tfe.RunConfigVer, tfe.RunConfigVerIngress},
+		})
+		if err != nil {
+			return status, fmt.Errorf("failed to read run '%s': %w", b.self.CurrentRun.ID, err)
 		}
-		if strings.Contains(arr.Name, "default_hostname") {
-			default_hostname = arr.Value.(string)
+		status.Run = &RunSummary{
+			ID:        r.ID,
+			Status:    string(r.Status),
+			URL:       runURL(b, r.ID),
+			CreatedAt: r.CreatedAt,
+			Duration:  runDuration(r).String(),
 		}
-		enc := json.NewEncoder(os.Stdout)
-		enc.SetIndent("", "  ")
-		if err := enc.Encode(outJson); err != nil {
-			log.Fatal(err)
+		if cv := r.ConfigurationVersion; cv != nil && cv.IngressAttributes != nil {
+			status.Commit = cv.IngressAttributes.CommitSHA
 		}
-	}
-
-	fmt.Println("[endgroup]")
 
-	if len(default_hostname) != 0 {
-		fmt.Println("##[section] URL: " + default_hostname)
+		// Outputs only exist once a state version has been created
+		outputs, err := b.getOutputs(ctx)
+		if err != nil {
+			return status, err
+		}
+		for _, output := range outputs {
+			status.Outputs = append(status.Outputs, output.Masked())
+		}
 	}
+
+	return status, nil
 }
 
 func (b *TfcIacBuilder) getWorkspace() Iac {
@@ -0,0 +1,884 @@
+package iac
+
+import (
+	"bytes"
+	"context"
+	"io"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	"main/interfaces/iac/tfctest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-tfe"
+)
+
+func newTestServer(t *testing.T) (*tfctest.Server, *config.Configuration) {
+	t.Helper()
+
+	srv := tfctest.NewServer(DefaultOrganization)
+	t.Cleanup(srv.Close)
+	srv.AddProject(PreviewProject)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := srv.WriteCABundle(bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &config.Configuration{List: map[string]config.KeyValue{}}
+	set(c, "TFC_API_TOKEN", "token")
+	set(c, "TFC_HOSTNAME", srv.Hostname())
+	set(c, "TFC_CA_BUNDLE", bundle)
+
+	return srv, c
+}
+
+func init() {
+	// Never prompt, even when the tests are run from a terminal
+	isInteractive = func() bool { return false }
+
+	// Assert on the Azure DevOps logging commands, wherever the tests run
+	ci.Use(ci.NewAzureDevOpsReporter(func(string) string { return "" }))
+}
+
+func newTestBuilder() *TfcIacBuilder {
+	b := newTfcIacBuilder()
+	b.poll_interval = time.Millisecond
+	return b
+}
+
+func set(c *config.Configuration, key string, value string) {
+	c.List[key] = config.KeyValue{Name: key, Value: value, ContentType: "text/plain"}
+}
+
+func setPreview(c *config.Configuration, expiration time.Time) string {
+	set(c, "SERVICE", "api")
+	set(c, "ENVIRONMENT", "dev")
+	set(c, "LOCATION", "eastus")
+	set(c, "BRANCH", "refs/heads/feature/login")
+	set(c, "EXPIRATION_DATE", strconv.FormatInt(expiration.Unix(), 10))
+	set(c, "ARM_TENANT_ID", "tenant")
+	set(c, "ARM_CLIENT_ID", "client")
+	set(c, "ARM_CLIENT_SECRET", "secret")
+	set(c, "tfvar:sku", "B1")
+
+	key := WorkspaceKey{Service: "api", Branch: "refs/heads/feature/login", Environment: "dev", Location: "eastus"}
+	name, _ := key.Name("", key.ID())
+	return name
+}
+
+// Captures everything written to stdout while fn runs.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+
+	return <-out
+}
+
+func buildAndRun(t *testing.T, c *config.Configuration) (string, error) {
+	t.Helper()
+
+	var err error
+	director := NewDirector(newTestBuilder())
+	out := captureStdout(t, func() {
+		if _, err = director.Build(context.Background(), c); err == nil {
+			err = director.Run(context.Background())
+		}
+	})
+	return out, err
+}
+
+func variableValues(vars []tfctest.Variable) map[string]tfctest.Variable {
+	m := make(map[string]tfctest.Variable)
+	for _, v := range vars {
+		m[v.Category+"/"+v.Key] = v
+	}
+	return m
+}
+
+func TestBuildCreatesWorkspace(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	expiration := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	name := setPreview(c, expiration)
+
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws, ok := srv.Workspace(name)
+	if !ok {
+		t.Fatalf("workspace '%s' was not created", name)
+	}
+	if ws.WorkingDirectory != "workspaces/api/dev/eastus" {
+		t.Errorf("working directory = %q", ws.WorkingDirectory)
+	}
+	for _, tag := range []string{"api", "branch:feature-login", "location:eastus", ExpirationTag(expiration)} {
+		if !slices.Contains(ws.Tags, tag) {
+			t.Errorf("tags %v missing %q", ws.Tags, tag)
+		}
+	}
+
+	vars := variableValues(srv.Variables(name))
+	want := map[string]string{
+		"env/ARM_TENANT_ID":         "tenant",
+		"env/ARM_CLIENT_ID":         "client",
+		"env/ARM_CLIENT_SECRET":     "secret",
+		"terraform/sku":             "B1",
+		"terraform/BUILD_ID":        WorkspaceKey{Service: "api", Branch: "feature/login", Environment: "dev", Location: "eastus"}.ID(),
+		"terraform/EXPIRATION_DATE": strconv.FormatInt(expiration.Unix(), 10),
+	}
+	if len(vars) != len(want) {
+		t.Errorf("got %d variables, want %d: %v", len(vars), len(want), vars)
+	}
+	for id, value := range want {
+		if vars[id].Value != value {
+			t.Errorf("%s = %q, want %q", id, vars[id].Value, value)
+		}
+	}
+	if !vars["env/ARM_CLIENT_SECRET"].Sensitive {
+		t.Error("ARM_CLIENT_SECRET is not sensitive")
+	}
+}
+
+func TestBuildReconcilesExistingWorkspace(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	name := setPreview(c, expiration)
+	set(c, "TFC_VARIABLE_SETS", "shared, global")
+
+	srv.AddWorkspace(name, PreviewProject, "api", ExpirationTag(time.Now()))
+	srv.AddVariable(name, tfctest.Variable{Key: "sku", Value: "F1", Category: CategoryTerraform})
+	srv.AddVariable(name, tfctest.Variable{Key: "stale", Value: "x", Description: ManagedVariableDescription, Category: CategoryTerraform})
+	srv.AddVariable(name, tfctest.Variable{Key: "sku", Value: "env", Description: ManagedVariableDescription, Category: CategoryEnv})
+	srv.AddVariable(name, tfctest.Variable{Key: "debug", Value: "true", Category: CategoryTerraform})
+	srv.AddVariableSet("shared", false)
+	srv.AddVariableSet("global", true)
+
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := srv.Workspaces(); n != 1 {
+		t.Fatalf("got %d workspaces, want the existing one reused", n)
+	}
+
+	ws, _ := srv.Workspace(name)
+	if got, _ := ParseExpirationTags(ws.Tags); !got.Equal(expiration) {
+		t.Errorf("expiration tag = %v, want %v", got, expiration)
+	}
+	if n := len(slices.DeleteFunc(slices.Clone(ws.Tags), func(tag string) bool {
+		return !strings.HasPrefix(tag, ExpirationTagPrefix)
+	})); n != 1 {
+		t.Errorf("got %d expiration tags, want 1: %v", n, ws.Tags)
+	}
+
+	vars := variableValues(srv.Variables(name))
+	if vars["terraform/sku"].Value != "B1" {
+		t.Errorf("terraform/sku = %q, want it updated to B1", vars["terraform/sku"].Value)
+	}
+	if vars["terraform/sku"].Description != ManagedVariableDescription {
+		t.Errorf("terraform/sku description = %q, want it marked as managed", vars["terraform/sku"].Description)
+	}
+	for _, id := range []string{"terraform/stale", "env/sku"} {
+		if _, ok := vars[id]; ok {
+			t.Errorf("undeclared variable %s was not removed", id)
+		}
+	}
+	if _, ok := vars["terraform/debug"]; !ok {
+		t.Error("variable set by hand was removed")
+	}
+
+	shared, _ := srv.VariableSet("shared")
+	if !slices.Contains(shared.WorkspaceIDs, ws.ID) {
+		t.Error("variable set 'shared' was not attached")
+	}
+	global, _ := srv.VariableSet("global")
+	if len(global.WorkspaceIDs) != 0 {
+		t.Error("global variable set was attached")
+	}
+}
+
+func TestBuildKeepsExpirationWithoutTTL(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now())
+	delete(c.List, "EXPIRATION_DATE")
+
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	srv.AddWorkspace(name, PreviewProject, "api", ExpirationTag(expiration))
+	srv.AddVariable(name, tfctest.Variable{
+		Key:         "EXPIRATION_DATE",
+		Value:       strconv.FormatInt(expiration.Unix(), 10),
+		Description: ManagedVariableDescription,
+		Category:    CategoryTerraform,
+	})
+
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws, _ := srv.Workspace(name)
+	if got, _ := ParseExpirationTags(ws.Tags); !got.Equal(expiration) {
+		t.Errorf("expiration tag = %v, want %v", got, expiration)
+	}
+	vars := variableValues(srv.Variables(name))
+	if got, want := vars["terraform/EXPIRATION_DATE"].Value, strconv.FormatInt(expiration.Unix(), 10); got != want {
+		t.Errorf("EXPIRATION_DATE = %q, want %q to match the tag", got, want)
+	}
+}
+
+func TestRunPollsUntilApplied(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses: []tfe.RunStatus{
+			tfe.RunPending,
+			tfe.RunPlanQueued,
+			tfe.RunPlanning,
+			tfe.RunPlanned,
+			tfe.RunApplyQueued,
+			tfe.RunApplying,
+			tfe.RunApplied,
+		},
+		ResourceCount: 3,
+		Outputs: []tfctest.Output{
+			{Name: "app_hostname", Type: "string", Value: "api.example.com"},
+			{Name: "password", Type: "string", Sensitive: true, Value: "hunter2"},
+		},
+	})
+
+	out, err := buildAndRun(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws, _ := srv.Workspace(name)
+	runs := srv.Runs(ws.ID)
+	if len(runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runs))
+	}
+	if runs[0].Status != tfe.RunApplied || !runs[0].AutoApply || runs[0].IsDestroy {
+		t.Errorf("run = %+v, want an auto-applied apply run", runs[0])
+	}
+	if ws.ResourceCount != 3 {
+		t.Errorf("resource count = %d, want 3", ws.ResourceCount)
+	}
+
+	for _, line := range []string{
+		`Run status "planning"`,
+		`Run status "applying"`,
+		`finished with status "applied"`,
+		"##vso[task.setvariable variable=app_hostname;isOutput=true]api.example.com",
+		"##vso[task.setvariable variable=password;isOutput=true;issecret=true]hunter2",
+		"##[section] URL: api.example.com",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output missing %q", line)
+		}
+	}
+	if strings.Contains(out, `"value": "hunter2"`) {
+		t.Error("sensitive output was printed unmasked")
+	}
+}
+
+func TestRunStatusReadsLatestRun(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	setPreview(c, time.Now().Add(time.Hour))
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses:      []tfe.RunStatus{tfe.RunPlanning, tfe.RunApplying, tfe.RunApplied},
+		ResourceCount: 2,
+		Outputs: []tfctest.Output{
+			{Name: "app_hostname", Type: "string", Value: "api.example.com"},
+			{Name: "password", Type: "string", Sensitive: true, Value: "hunter2"},
+		},
+	})
+
+	// The same director notify reads the start notification from
+	ctx := context.Background()
+	director := NewDirector(newTestBuilder())
+	var status Status
+	var err error
+	captureStdout(t, func() {
+		if _, err = director.Build(ctx, c); err != nil {
+			return
+		}
+		if err = director.Run(ctx); err != nil {
+			return
+		}
+		status, err = director.RunStatus(ctx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Run == nil || status.Run.Status != string(tfe.RunApplied) {
+		t.Errorf("run = %+v, want the applied run", status.Run)
+	}
+	if status.ResourceCount != 2 {
+		t.Errorf("resource count = %d, want 2", status.ResourceCount)
+	}
+	if len(status.URL) == 0 {
+		t.Error("got no workspace URL")
+	}
+	outputs := make(map[string]string)
+	for _, o := range status.Outputs {
+		outputs[o.Name] = o.String()
+	}
+	if outputs["app_hostname"] != "api.example.com" {
+		t.Errorf("outputs = %v, want app_hostname", outputs)
+	}
+	if password, ok := outputs["password"]; !ok || password == "hunter2" {
+		t.Errorf("outputs = %v, want password masked", outputs)
+	}
+}
+
+func TestRunConfirmsWithinCostGuardrail(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "MAX_MONTHLY_COST", "100")
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses: []tfe.RunStatus{
+			tfe.RunPlanning,
+			tfe.RunCostEstimated,
+			tfe.RunApplying,
+			tfe.RunApplied,
+		},
+		CostEstimate: &tfctest.CostEstimate{Proposed: "42.50", Prior: "0", Delta: "42.50"},
+	})
+
+	out, err := buildAndRun(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws, _ := srv.Workspace(name)
+	run := srv.Runs(ws.ID)[0]
+	if run.AutoApply {
+		t.Error("guarded run was created with auto-apply")
+	}
+	if run.Status != tfe.RunApplied {
+		t.Errorf("status = %q, want applied", run.Status)
+	}
+	if !slices.Equal(run.Comments, []string{"Approved via SDK"}) {
+		t.Errorf("comments = %v, want a single approval", run.Comments)
+	}
+	if !strings.Contains(out, "Estimated Monthly Cost: $42.50") {
+		t.Error("cost estimate was not reported")
+	}
+}
+
+func TestRunDiscardsWithoutCostEstimate(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "MAX_MONTHLY_COST", "100")
+	set(c, "KEEP_ON_FAILURE", "true")
+
+	// Cost estimation is disabled for the organization
+	srv.QueueRun(tfctest.RunScript{
+		Statuses: []tfe.RunStatus{
+			tfe.RunPlanning,
+			tfe.RunPlanned,
+			tfe.RunApplying,
+			tfe.RunApplied,
+		},
+	})
+
+	_, err := buildAndRun(t, c)
+	if err == nil || !strings.Contains(err.Error(), "No finished cost estimate") {
+		t.Fatalf("err = %v, want the run discarded without a cost estimate", err)
+	}
+
+	ws, _ := srv.Workspace(name)
+	run := srv.Runs(ws.ID)[0]
+	if run.Status != tfe.RunDiscarded {
+		t.Errorf("status = %q, want discarded", run.Status)
+	}
+}
+
+func TestExtendGuardsCost(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	ws := srv.AddWorkspace("api-dev", PreviewProject, "api", ExpirationTag(time.Now().Add(time.Hour)))
+	set(c, "TFC_WORKSPACE", ws.Name)
+	set(c, "SERVICE", "api")
+	set(c, "MAX_MONTHLY_COST", "100")
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses: []tfe.RunStatus{tfe.RunPlanning, tfe.RunPlanned, tfe.RunApplying, tfe.RunApplied},
+	})
+
+	var err error
+	captureStdout(t, func() {
+		err = NewDirector(newTestBuilder()).Extend(context.Background(), c, time.Hour)
+	})
+	if err == nil || !strings.Contains(err.Error(), "No finished cost estimate") {
+		t.Fatalf("err = %v, want the extend run discarded without a cost estimate", err)
+	}
+	if run := srv.Runs(ws.ID)[0]; run.Status != tfe.RunDiscarded {
+		t.Errorf("status = %q, want discarded", run.Status)
+	}
+}
+
+func TestRunReportsErroredPlanLogs(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+
+	set(c, "KEEP_ON_FAILURE", "true")
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses: []tfe.RunStatus{tfe.RunPlanning, tfe.RunErrored},
+		PlanLog: strings.Join([]string{
+			"Terraform v1.5.0",
+			`{"@level":"info","@message":"Plan: 1 to add"}`,
+			`{"@level":"error","@message":"Error: Invalid reference","type":"diagnostic","diagnostic":{"severity":"error","summary":"Invalid reference","detail":"A reference to a resource type must be followed by a name."}}`,
+		}, "\n"),
+	})
+
+	out, err := buildAndRun(t, c)
+	if err == nil {
+		t.Fatal("Run succeeded, want the run's error")
+	}
+
+	ws, ok := srv.Workspace(name)
+	if !ok {
+		t.Fatal("workspace was rolled back despite KEEP_ON_FAILURE")
+	}
+	if status := srv.Runs(ws.ID)[0].Status; status != tfe.RunErrored {
+		t.Fatalf("status = %q, want errored", status)
+	}
+
+	for _, line := range []string{
+		"##[error] Run had errors!",
+		"Reading plan logs of run",
+		"##[error] Invalid reference\n##[info] A reference to a resource type must be followed by a name.\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output missing %q", line)
+		}
+	}
+	if strings.Contains(out, "Plan: 1 to add") {
+		t.Error("non-error log lines were printed")
+	}
+}
+
+func TestDismantleDestroysAndDeletes(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	srv.AddProject("default")
+	ws := srv.AddWorkspace("api-0A1B2C3D-dev-eastus", PreviewProject, "api")
+	srv.AddWorkspace("api-0A1B2C3D-dev-eastus-legacy", "default")
+	set(c, "TFC_WORKSPACE", ws.Name)
+
+	var err error
+	out := captureStdout(t, func() {
+		err = NewDirector(newTestBuilder()).Dismantle(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := srv.Runs(ws.ID)
+	if len(runs) != 1 || !runs[0].IsDestroy || runs[0].Status != tfe.RunApplied {
+		t.Fatalf("runs = %+v, want a single applied destroy run", runs)
+	}
+	if n := srv.Workspaces(); n != 1 {
+		t.Errorf("got %d workspaces, want only the one outside the preview project left", n)
+	}
+	if !strings.Contains(out, "Workspace '"+ws.Name+"' deleted.") {
+		t.Error("deletion was not reported")
+	}
+}
+
+func TestRunDeletesEmptyWorkspaceOnFailure(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	setPreview(c, time.Now().Add(time.Hour))
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses: []tfe.RunStatus{tfe.RunPlanning, tfe.RunErrored},
+	})
+
+	out, err := buildAndRun(t, c)
+	if err == nil {
+		t.Fatal("Run succeeded, want the run's error")
+	}
+	if n := srv.Workspaces(); n != 0 {
+		t.Errorf("got %d workspaces, want the created one deleted", n)
+	}
+	if n := strings.Count(out, "##[group]Create Workspace Run"); n != 1 {
+		t.Errorf("got %d runs, want the empty workspace deleted without a destroy run", n)
+	}
+}
+
+func TestRunDestroysHalfAppliedWorkspace(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	setPreview(c, time.Now().Add(time.Hour))
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses:      []tfe.RunStatus{tfe.RunPlanning, tfe.RunApplying, tfe.RunErrored},
+		ResourceCount: 2,
+	})
+
+	out, err := buildAndRun(t, c)
+	if err == nil {
+		t.Fatal("Run succeeded, want the run's error")
+	}
+	if n := srv.Workspaces(); n != 0 {
+		t.Errorf("got %d workspaces, want the created one deleted", n)
+	}
+	for _, line := range []string{
+		`finished with status "errored"`,
+		"Rolling back workspace",
+		`finished with status "applied"`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output missing %q", line)
+		}
+	}
+}
+
+func TestRunKeepsExistingWorkspaceOnFailure(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	ws := srv.AddWorkspace(name, PreviewProject, "api")
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses:      []tfe.RunStatus{tfe.RunPlanning, tfe.RunApplying, tfe.RunErrored},
+		ResourceCount: 2,
+	})
+
+	if _, err := buildAndRun(t, c); err == nil {
+		t.Fatal("Run succeeded, want the run's error")
+	}
+	if _, ok := srv.Workspace(name); !ok {
+		t.Fatal("existing workspace was deleted")
+	}
+	if runs := srv.Runs(ws.ID); len(runs) != 1 {
+		t.Errorf("got %d runs, want no destroy run", len(runs))
+	}
+}
+
+func findWorkspace(t *testing.T, c *config.Configuration) (*TfcIacBuilder, error) {
+	t.Helper()
+
+	var err error
+	b := newTestBuilder()
+	captureStdout(t, func() {
+		err = b.findWorkspace(context.Background(), c)
+	})
+	return b, err
+}
+
+func TestFindWorkspaceByExactNameOrID(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	srv.AddProject("default")
+	want := srv.AddWorkspace("my-app-1", PreviewProject, "api")
+	srv.AddWorkspace("my-app-10", PreviewProject, "api")
+	srv.AddWorkspace("my-app-11", PreviewProject, "api")
+	outside := srv.AddWorkspace("other-app", "default", "api")
+
+	for _, target := range []string{want.Name, want.ID} {
+		set(c, "TFC_WORKSPACE", target)
+		b, err := findWorkspace(t, c)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if b.self.ID != want.ID || b.Workspace.name != want.Name {
+			t.Errorf("%s: found %s (%s), want %s", target, b.self.Name, b.self.ID, want.Name)
+		}
+	}
+
+	set(c, "TFC_WORKSPACE", "my-app")
+	if _, err := findWorkspace(t, c); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("partial name: err = %v, want not found", err)
+	}
+
+	set(c, "TFC_WORKSPACE", outside.ID)
+	if _, err := findWorkspace(t, c); err == nil {
+		t.Error("found a workspace outside of the preview project")
+	}
+}
+
+func TestFindReadsWorkspaceService(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	srv.AddWorkspace("my-app-1", PreviewProject, "my-app", "branch:main", "expires:1700000000")
+	srv.AddWorkspace("untagged", PreviewProject, "branch:main")
+	srv.AddWorkspace("ambiguous", PreviewProject, "my-app", "debug")
+
+	cases := []struct {
+		workspace string
+		want      string
+		err       bool
+	}{
+		{"my-app-1", "my-app", false},
+		{"untagged", "", true},
+		{"ambiguous", "", true},
+	}
+
+	for _, tc := range cases {
+		set(c, "TFC_WORKSPACE", tc.workspace)
+		director := NewDirector(newTestBuilder())
+		var err error
+		captureStdout(t, func() { err = director.Find(context.Background(), c) })
+		if err != nil {
+			t.Fatalf("%s: %v", tc.workspace, err)
+		}
+		got, err := director.WorkspaceService()
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("%s: got %q, %v, want %q", tc.workspace, got, err, tc.want)
+		}
+	}
+}
+
+func TestFindWorkspaceByTags(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	srv.AddWorkspace("api-login", PreviewProject, "api", "branch:feature-login", OwnerTagPrefix+"jane")
+	srv.AddWorkspace("api-search", PreviewProject, "api", "branch:feature-search", OwnerTagPrefix+"jane")
+	srv.AddWorkspace("web-login", PreviewProject, "web", "branch:feature-login")
+
+	// Falls back to tags when the name is not found
+	set(c, "TFC_WORKSPACE", "api-gone")
+	set(c, "SERVICE", "api")
+	set(c, "BRANCH", "refs/heads/feature/login")
+	b, err := findWorkspace(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.self.Name != "api-login" {
+		t.Errorf("found %s, want api-login", b.self.Name)
+	}
+
+	// Several matches cannot be resolved without a terminal
+	set(c, "TFC_WORKSPACE", "")
+	set(c, "BRANCH", "")
+	set(c, "OWNER", "jane")
+	if _, err := findWorkspace(t, c); err == nil || !strings.Contains(err.Error(), "api-login, api-search") {
+		t.Errorf("err = %v, want both candidates listed", err)
+	}
+
+	set(c, "SERVICE", "worker")
+	if _, err := findWorkspace(t, c); err == nil {
+		t.Error("found a workspace for a service without previews")
+	}
+}
+
+func TestSelectPreviews(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	srv.AddWorkspace("api-login-eastus", PreviewProject, "api", "branch:feature-login", "location:eastus", "team:core")
+	srv.AddWorkspace("api-login-westus", PreviewProject, "api", "branch:feature-login", "location:westus")
+	srv.AddWorkspace("web-login-eastus", PreviewProject, "web", "branch:feature-login", "location:eastus", "team:core")
+	srv.AddWorkspace("api-elsewhere", "default", "api", "location:eastus")
+
+	var (
+		previews []Preview
+		err      error
+	)
+	captureStdout(t, func() {
+		previews, err = NewDirector(newTestBuilder()).List(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(previews []Preview) []string {
+		var names []string
+		for _, p := range previews {
+			names = append(names, p.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	tests := []struct {
+		selector map[string]string
+		want     []string
+	}{
+		{map[string]string{"SERVICE": "api"}, []string{"api-login-eastus", "api-login-westus"}},
+		{map[string]string{"LOCATION": "eastus"}, []string{"api-login-eastus", "web-login-eastus"}},
+		{map[string]string{"SERVICE": "api", "LOCATION": "eastus"}, []string{"api-login-eastus"}},
+		{map[string]string{"TAGS": "team:core, location:eastus"}, []string{"api-login-eastus", "web-login-eastus"}},
+		{map[string]string{"SERVICE": "worker"}, nil},
+	}
+	for _, tt := range tests {
+		selector := &config.Configuration{List: map[string]config.KeyValue{}}
+		for key, value := range tt.selector {
+			set(selector, key, value)
+		}
+		if got := names(SelectPreviews(previews, selector)); !slices.Equal(got, tt.want) {
+			t.Errorf("%v selected %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestBuildAttachesNotifications(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "TFC_NOTIFICATIONS", `[
+		{ "name": "team", "type": "slack", "url": "https://hooks.slack.test/1" },
+		{ "name": "audit", "type": "generic", "url": "https://audit.test", "token": "secret", "triggers": ["run:errored"] }
+	]`)
+
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ncs := srv.NotificationConfigurations(name)
+	if len(ncs) != 2 {
+		t.Fatalf("got %d notification configurations, want 2: %v", len(ncs), ncs)
+	}
+	if nc := ncs[0]; nc.Name != "team" || nc.DestinationType != "slack" || !nc.Enabled || !slices.Equal(nc.Triggers, []string{"run:completed", "run:errored"}) {
+		t.Errorf("team = %+v", nc)
+	}
+	if nc := ncs[1]; nc.DestinationType != "generic" || nc.Token != "secret" || !slices.Equal(nc.Triggers, []string{"run:errored"}) {
+		t.Errorf("audit = %+v", nc)
+	}
+
+	// Reused workspaces keep the notifications they have
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.NotificationConfigurations(name)); got != 2 {
+		t.Errorf("got %d notification configurations after reuse, want 2", got)
+	}
+}
+
+func TestBuildRejectsInvalidNotifications(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	setPreview(c, time.Now().Add(time.Hour))
+	set(c, "TFC_NOTIFICATIONS", `[{ "name": "team", "type": "email", "url": "https://example.test" }]`)
+
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported type 'email'") {
+		t.Errorf("err = %v, want unsupported type", err)
+	}
+	if srv.Workspaces() != 0 {
+		t.Error("workspace was created for an invalid configuration")
+	}
+}
+
+func TestListIncludesLatestRun(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "KEEP_ON_FAILURE", "true")
+	srv.AddWorkspace("idle", PreviewProject, "api")
+
+	srv.QueueRun(tfctest.RunScript{
+		Statuses:      []tfe.RunStatus{tfe.RunPlanning, tfe.RunPlanned, tfe.RunApplying, tfe.RunErrored},
+		ResourceCount: 2,
+	})
+	if _, err := buildAndRun(t, c); err == nil {
+		t.Fatal("Run succeeded, want the run's error")
+	}
+
+	var (
+		previews []Preview
+		err      error
+	)
+	captureStdout(t, func() {
+		previews, err = NewDirector(newTestBuilder()).List(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]Preview)
+	for _, p := range previews {
+		got[p.Name] = p
+	}
+	if p := got[name]; p.RunStatus != string(tfe.RunErrored) || p.ResourceCount != 2 {
+		t.Errorf("%s: run status = %q, resource count = %d", name, p.RunStatus, p.ResourceCount)
+	}
+	if p := got["idle"]; p.RunStatus != "" || p.ResourceCount != 0 {
+		t.Errorf("idle: run status = %q, resource count = %d", p.RunStatus, p.ResourceCount)
+	}
+}
+
+func TestExistsLooksAcrossProjects(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	srv.AddProject("production")
+	srv.AddWorkspace("api-dev", PreviewProject, "api")
+	srv.AddWorkspace("api-moved", "production", "api")
+
+	// Exists reuses the connection List made
+	var err error
+	director := NewDirector(newTestBuilder())
+	captureStdout(t, func() { _, err = director.List(context.Background(), c) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"api-dev": true, "api-moved": true, "api-gone": false} {
+		exists, err := director.Exists(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("%s: exists = %v, want %v", name, exists, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package iac
+
+import (
+	"fmt"
+	config "main/interfaces/configuration"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Workspace tags cannot contain the characters of a timestamp, so the
+// expiration is stored in unix seconds, matching the ExpirationDate tag
+// expected on Azure resources.
+const ExpirationTagPrefix = "expires:"
+
+func ExpirationTag(t time.Time) string {
+	return ExpirationTagPrefix + strconv.FormatInt(t.Unix(), 10)
+}
+
+// ParseExpirationTags returns the expiration stored in a workspace's tags.
+func ParseExpirationTags(tags []string) (time.Time, bool) {
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, ExpirationTagPrefix); ok {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			return time.Unix(seconds, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// GetExpiration returns the expiration requested for a preview, if any.
+func GetExpiration(c *config.Configuration) (time.Time, bool) {
+	value := c.List["EXPIRATION_DATE"].Value
+	if len(value) == 0 {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// GetTTL returns the default TTL for a service from the TTL key.
+func GetTTL(c *config.Configuration) (time.Duration, error) {
+	value := c.List["TTL"].Value
+	if len(value) == 0 {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TTL '%s': %w", value, err)
+	}
+	return ttl, nil
+}
+
+// CheckExpiration validates that an expiration is in the future and no
+// further out than the service's MAX_TTL.
+func CheckExpiration(c *config.Configuration, expiration time.Time) error {
+
+	if !expiration.After(time.Now()) {
+		return fmt.Errorf("expiration '%s' is in the past", expiration.Format(time.RFC3339))
+	}
+
+	value := c.List["MAX_TTL"].Value
+	if len(value) == 0 {
+		return nil
+	}
+
+	max_ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid MAX_TTL '%s': %w", value, err)
+	}
+
+	if latest := time.Now().Add(max_ttl); expiration.After(latest) {
+		return fmt.Errorf("expiration '%s' exceeds the maximum TTL of %s (latest allowed '%s')",
+			expiration.Format(time.RFC3339), max_ttl, latest.Format(time.RFC3339))
+	}
+
+	return nil
+}
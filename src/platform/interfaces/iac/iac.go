@@ -1,6 +1,159 @@
 package iac
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	config "main/interfaces/configuration"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Default naming scheme used when TFC_WORKSPACE_TEMPLATE is not configured.
+const defaultWorkspaceTemplate = "{{.Service}}-{{.Key}}-{{.Environment}}-{{.Location}}"
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
 type Iac struct {
 	name              string
 	working_directory string
+
+	// Set when the workspace was created by this build, rather than reused
+	created bool
+
+	// Tags of the workspace found by a lookup
+	tags []string
+}
+
+// ServiceFromTags returns the service a workspace belongs to. The service is
+// the only tag without a prefix.
+func ServiceFromTags(tags []string) (string, error) {
+	var services []string
+	for _, tag := range tags {
+		if !strings.Contains(tag, ":") {
+			services = append(services, tag)
+		}
+	}
+	switch len(services) {
+	case 0:
+		return "", errors.New("workspace has no service tag")
+	case 1:
+		return services[0], nil
+	}
+	return "", fmt.Errorf("workspace has several service tags '%s'", strings.Join(services, ", "))
+}
+
+// Preview summarizes a workspace in the preview project.
+type Preview struct {
+	Name       string    `json:"name"`
+	ID         string    `json:"id"`
+	Tags       []string  `json:"tags"`
+	CreatedAt  time.Time `json:"created_at"`
+	Expiration time.Time `json:"expiration"`
+
+	// Status of the latest run, and the resources in state
+	RunStatus     string `json:"run_status,omitempty"`
+	ResourceCount int    `json:"resource_count"`
+}
+
+// IsExpired reports whether the preview expired more than grace ago.
+// Previews without an expiration never expire.
+func (p Preview) IsExpired(grace time.Duration) bool {
+	return !p.Expiration.IsZero() && p.Expiration.Add(grace).Before(time.Now())
+}
+
+// WorkspaceKey identifies a preview independently of the backend hosting it.
+// The same service, ref, environment and location always produce the same key.
+type WorkspaceKey struct {
+	Service     string
+	Branch      string
+	PullRequest string
+	Environment string
+	Location    string
+}
+
+// GetWorkspaceKey returns the key of the preview a configuration describes.
+func GetWorkspaceKey(c *config.Configuration) WorkspaceKey {
+	return WorkspaceKey{
+		Service:     c.List["SERVICE"].Value,
+		Branch:      c.List["BRANCH"].Value,
+		PullRequest: c.List["PULL_REQUEST"].Value,
+		Environment: c.List["ENVIRONMENT"].Value,
+		Location:    c.List["LOCATION"].Value,
+	}
+}
+
+// Values available to a workspace naming template.
+type WorkspaceNameData struct {
+	Service     string
+	Branch      string
+	PullRequest string
+	Environment string
+	Location    string
+	Key         string
+}
+
+// Slugify lowercases a value and replaces anything that is not a letter,
+// digit or hyphen so it is safe to use in workspace names and tags.
+func Slugify(value string) string {
+	value = strings.TrimPrefix(value, "refs/heads/")
+	value = invalidNameChars.ReplaceAllString(strings.ToLower(value), "-")
+	return strings.Trim(value, "-")
+}
+
+// Ref returns the pull request or branch the preview was built from.
+func (k WorkspaceKey) Ref() string {
+	if len(k.PullRequest) != 0 {
+		return "pr-" + k.PullRequest
+	}
+	return Slugify(k.Branch)
+}
+
+// IsDeterministic reports whether the key has a ref to derive an ID from.
+func (k WorkspaceKey) IsDeterministic() bool {
+	return len(k.Ref()) != 0
+}
+
+// ID returns a short, stable hash of the key.
+func (k WorkspaceKey) ID() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		k.Service,
+		k.Ref(),
+		k.Environment,
+		k.Location,
+	}, "/")))
+	return strings.ToUpper(hex.EncodeToString(sum[:])[:8])
+}
+
+// Name renders the workspace name from a text/template, falling back to the
+// default scheme when tmpl is empty.
+func (k WorkspaceKey) Name(tmpl string, id string) (string, error) {
+
+	if len(tmpl) == 0 {
+		tmpl = defaultWorkspaceTemplate
+	}
+
+	t, err := template.New("workspace").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var name bytes.Buffer
+	err = t.Execute(&name, WorkspaceNameData{
+		Service:     k.Service,
+		Branch:      Slugify(k.Branch),
+		PullRequest: k.PullRequest,
+		Environment: k.Environment,
+		Location:    k.Location,
+		Key:         id,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return name.String(), nil
 }
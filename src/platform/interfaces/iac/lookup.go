@@ -0,0 +1,113 @@
+package iac
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the tag recording the Azure region a preview was built in.
+const LocationTagPrefix = "location:"
+
+// SelectorTags returns the tags a preview must have to match the SERVICE,
+// BRANCH, OWNER and LOCATION selectors and the comma separated TAGS. Unset
+// selectors are skipped.
+func SelectorTags(c *config.Configuration) []string {
+
+	var tags []string
+	if service := c.List["SERVICE"].Value; len(service) != 0 {
+		tags = append(tags, service)
+	}
+	if branch := Slugify(c.List["BRANCH"].Value); len(branch) != 0 {
+		tags = append(tags, "branch:"+branch)
+	}
+	if owner := c.List["OWNER"].Value; len(owner) != 0 {
+		tags = append(tags, OwnerTag(owner))
+	}
+	if location := c.List["LOCATION"].Value; len(location) != 0 {
+		tags = append(tags, LocationTagPrefix+location)
+	}
+	for _, tag := range strings.Split(c.List["TAGS"].Value, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) != 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// SelectPreviews returns the previews tagged with every selector tag.
+func SelectPreviews(previews []Preview, c *config.Configuration) []Preview {
+
+	var selected []Preview
+	selector := SelectorTags(c)
+	for _, preview := range previews {
+		if matchesTags(preview.Tags, selector) {
+			selected = append(selected, preview)
+		}
+	}
+	return selected
+}
+
+// Reports whether tags contains every selector tag.
+func matchesTags(tags []string, selector []string) bool {
+	for _, tag := range selector {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Picks one of several workspaces matching a selector. Without a terminal
+// to ask, the lookup fails and lists the candidates.
+func chooseWorkspace(names []string) (string, error) {
+
+	if len(names) == 1 {
+		return names[0], nil
+	}
+
+	if !isInteractive() {
+		return "", fmt.Errorf("'%d' workspaces match: %s. Use --workspace to choose one", len(names), strings.Join(names, ", "))
+	}
+
+	ci.Info("Found '%d' matching Workspace(s)", len(names))
+	for i, name := range names {
+		fmt.Printf("  %d) %s\n", i+1, name)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Select a workspace [1-%d]: ", len(names))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("no workspace selected: %w", err)
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && i >= 1 && i <= len(names) {
+			return names[i-1], nil
+		}
+	}
+}
+
+// Confirm asks a yes/no question on the terminal. Without a terminal to ask,
+// it fails rather than assuming an answer.
+func Confirm(question string) (bool, error) {
+
+	if !isInteractive() {
+		return false, errors.New("no terminal to confirm on")
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
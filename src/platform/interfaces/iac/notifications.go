@@ -0,0 +1,53 @@
+package iac
+
+import (
+	"encoding/json"
+	"fmt"
+	config "main/interfaces/configuration"
+	"slices"
+)
+
+// Notification is a Terraform Cloud notification configuration attached to
+// the workspace of every new preview. Type is one of 'generic', 'slack' or
+// 'microsoft-teams'. Triggers default to completed and errored runs.
+type Notification struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	URL      string   `json:"url"`
+	Token    string   `json:"token,omitempty"`
+	Triggers []string `json:"triggers,omitempty"`
+}
+
+var defaultNotificationTriggers = []string{
+	"run:completed",
+	"run:errored",
+}
+
+// Returns the notification configurations declared by TFC_NOTIFICATIONS.
+func getNotifications(c *config.Configuration) ([]Notification, error) {
+
+	value := c.List["TFC_NOTIFICATIONS"].Value
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	var notifications []Notification
+	if err := json.Unmarshal([]byte(value), &notifications); err != nil {
+		return nil, fmt.Errorf("invalid TFC_NOTIFICATIONS: %w", err)
+	}
+
+	supported := []string{"generic", "slack", "microsoft-teams"}
+	for i, n := range notifications {
+		if len(n.Name) == 0 || len(n.URL) == 0 {
+			return nil, fmt.Errorf("invalid TFC_NOTIFICATIONS: notification '%d' requires a name and url", i+1)
+		}
+		if !slices.Contains(supported, n.Type) {
+			return nil, fmt.Errorf("invalid TFC_NOTIFICATIONS: notification '%s' has unsupported type '%s'. Allowed Value: %v", n.Name, n.Type, supported)
+		}
+		if len(n.Triggers) == 0 {
+			notifications[i].Triggers = defaultNotificationTriggers
+		}
+	}
+
+	return notifications, nil
+}
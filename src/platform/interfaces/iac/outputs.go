@@ -0,0 +1,134 @@
+package iac
+
+import (
+	"encoding/json"
+	"fmt"
+	ci "main/interfaces/ci"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const SensitiveMask = "(sensitive)"
+
+// Output is a root module output read from the workspace state.
+type Output struct {
+	Name      string      `json:"name" yaml:"name"`
+	Type      string      `json:"type" yaml:"type"`
+	Sensitive bool        `json:"sensitive" yaml:"sensitive"`
+	Value     interface{} `json:"value" yaml:"value"`
+}
+
+// String renders the value on a single line. Strings are returned as-is,
+// every other type is JSON encoded.
+func (o Output) String() string {
+	switch v := o.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// Characters that can be written to an env file without quoting.
+var envSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]*$`)
+
+// Env renders the output as a NAME=value line of an env file. Values are
+// quoted for the shell unless they only hold safe characters, and values
+// spanning lines are rejected.
+func (o Output) Env() (string, error) {
+	value := o.String()
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("output '%s' spans several lines and cannot be written as env", o.Name)
+	}
+	if !envSafe.MatchString(value) {
+		value = "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+	return o.Name + "=" + value, nil
+}
+
+// Masked returns a copy of the output with a sensitive value hidden.
+func (o Output) Masked() Output {
+	if o.Sensitive {
+		o.Value = SensitiveMask
+	}
+	return o
+}
+
+// IsURL reports whether the output looks like an endpoint worth surfacing
+// in the run summary.
+func (o Output) IsURL() bool {
+	if o.Sensitive {
+		return false
+	}
+	if _, ok := o.Value.(string); !ok {
+		return false
+	}
+	name := strings.ToLower(o.Name)
+	return strings.Contains(name, "hostname") || strings.HasSuffix(name, "url")
+}
+
+// PublishOutputs sets every output as a step output named after the prefix
+// and the output, and returns the values of outputs that look like URLs.
+func PublishOutputs(outputs []Output, prefix string) []string {
+	var urls []string
+	for _, output := range outputs {
+		ci.SetOutput(prefix+output.Name, output.String(), output.Sensitive)
+		if output.IsURL() {
+			urls = append(urls, output.String())
+		}
+	}
+	return urls
+}
+
+// OutputSummary renders the outputs of a workspace as a Markdown table for
+// the step summary. Sensitive values are masked.
+func OutputSummary(workspace string, outputs []Output) string {
+
+	escaper := strings.NewReplacer("|", "\\|", "\r", " ", "\n", " ")
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "### Preview `%s`\n\n", workspace)
+	if len(outputs) == 0 {
+		summary.WriteString("No outputs.\n")
+		return summary.String()
+	}
+	summary.WriteString("| Output | Value |\n| --- | --- |\n")
+	for _, output := range outputs {
+		fmt.Fprintf(&summary, "| %s | %s |\n", output.Name, escaper.Replace(output.Masked().String()))
+	}
+	return summary.String()
+}
+
+// Publishes the outputs of a run, prints them masked and highlights URLs.
+func printOutputs(workspace string, outputs []Output) error {
+
+	ci.Group("Terraform Output")
+	urls := PublishOutputs(outputs, "")
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for _, output := range outputs {
+		if err := enc.Encode(output.Masked()); err != nil {
+			ci.EndGroup()
+			return err
+		}
+	}
+	ci.EndGroup()
+
+	for _, url := range urls {
+		ci.Section("URL: %s", url)
+	}
+	ci.Summary(OutputSummary(workspace, outputs))
+	return nil
+}
@@ -0,0 +1,72 @@
+package iac
+
+import "testing"
+
+func TestOutputString(t *testing.T) {
+
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"api.example.com", "api.example.com"},
+		{true, "true"},
+		{float64(3), "3"},
+		{1.5, "1.5"},
+		{[]interface{}{"eastus", "westus"}, `["eastus","westus"]`},
+		{map[string]interface{}{"sku": "B1"}, `{"sku":"B1"}`},
+	}
+
+	for _, c := range cases {
+		if got := (Output{Name: "out", Value: c.value}).String(); got != c.want {
+			t.Errorf("String(%#v) = %q, want %q", c.value, got, c.want)
+		}
+	}
+}
+
+func TestOutputMasked(t *testing.T) {
+
+	secret := Output{Name: "password", Type: "string", Sensitive: true, Value: "hunter2"}
+	if got := secret.Masked(); got.Value != SensitiveMask || got.Name != "password" {
+		t.Errorf("Masked() = %+v, want the value hidden", got)
+	}
+	if secret.Value != "hunter2" {
+		t.Error("Masked() changed the original output")
+	}
+
+	public := Output{Name: "app_hostname", Type: "string", Value: "api.example.com"}
+	if got := public.Masked(); got.Value != "api.example.com" {
+		t.Errorf("Masked() = %+v, want the value kept", got)
+	}
+}
+
+func TestOutputEnv(t *testing.T) {
+
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{"api.example.com", "out=api.example.com"},
+		{"https://api.example.com/health", "out=https://api.example.com/health"},
+		{"two words", "out='two words'"},
+		{"it's", `out='it'\''s'`},
+		{"$HOME", "out='$HOME'"},
+		{[]interface{}{"eastus"}, `out='["eastus"]'`},
+		{nil, "out="},
+	}
+
+	for _, c := range cases {
+		got, err := (Output{Name: "out", Value: c.value}).Env()
+		if err != nil {
+			t.Errorf("Env(%#v) returned %v", c.value, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Env(%#v) = %q, want %q", c.value, got, c.want)
+		}
+	}
+
+	if _, err := (Output{Name: "certificate", Value: "line 1\nline 2"}).Env(); err == nil {
+		t.Error("got no error, want multiline values rejected")
+	}
+}
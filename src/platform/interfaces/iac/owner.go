@@ -0,0 +1,92 @@
+package iac
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CI variables naming who triggered a pipeline run, most specific first.
+var ownerVariables = []string{
+	"BUILD_REQUESTEDFOREMAIL", // Azure Pipelines
+	"GITLAB_USER_EMAIL",       // GitLab CI
+	"GITHUB_TRIGGERING_ACTOR", // GitHub Actions
+	"GITHUB_ACTOR",
+}
+
+// OwnerTag returns the workspace tag recording who created a preview.
+// Terraform Cloud tags cannot hold an e-mail address, so the owner is
+// slugified.
+func OwnerTag(owner string) string {
+	return OwnerTagPrefix + Slugify(owner)
+}
+
+// OwnedBy reports whether the preview was created by the owner.
+func (p Preview) OwnedBy(owner string) bool {
+	return slices.Contains(p.Tags, OwnerTag(owner))
+}
+
+// OwnerFromEnvironment returns who triggered the current CI run, or an empty
+// string outside of a pipeline.
+func OwnerFromEnvironment(getenv func(string) string) string {
+	for _, name := range ownerVariables {
+		if owner := strings.TrimSpace(getenv(name)); len(owner) != 0 {
+			return owner
+		}
+	}
+	return ""
+}
+
+// OwnerFromToken returns the user principal name an Azure access token was
+// issued to, or its object ID for service principals and managed identities.
+// The token is not verified; it only attributes the preview.
+func OwnerFromToken(token string) (string, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid access token: %w", err)
+	}
+
+	var claims struct {
+		UPN               string `json:"upn"`
+		PreferredUsername string `json:"preferred_username"`
+		OID               string `json:"oid"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("invalid access token: %w", err)
+	}
+
+	for _, owner := range []string{claims.UPN, claims.PreferredUsername, claims.OID} {
+		if len(owner) != 0 {
+			return owner, nil
+		}
+	}
+	return "", errors.New("access token has no upn, preferred_username or oid claim")
+}
+
+func ownerVariable(owner string) Variable {
+	return Variable{
+		Key:      "OWNER",
+		Value:    owner,
+		Category: CategoryTerraform,
+	}
+}
+
+// Returns the OWNER Terraform variable. A preview keeps the owner it was
+// created by, so the current value wins over the OWNER configuration.
+func getOwnerVariable(owner string, current string) (Variable, bool) {
+	if len(current) != 0 {
+		return ownerVariable(current), true
+	}
+	if len(owner) != 0 {
+		return ownerVariable(owner), true
+	}
+	return Variable{}, false
+}
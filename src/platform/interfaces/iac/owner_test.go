@@ -0,0 +1,99 @@
+package iac
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testToken(claims string) string {
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestOwnerFromToken(t *testing.T) {
+
+	tests := map[string]struct {
+		token string
+		want  string
+	}{
+		"user":              {testToken(`{"upn":"jane.doe@contoso.com","oid":"1234"}`), "jane.doe@contoso.com"},
+		"guest":             {testToken(`{"preferred_username":"jane@fabrikam.com","oid":"1234"}`), "jane@fabrikam.com"},
+		"service principal": {testToken(`{"oid":"1234"}`), "1234"},
+	}
+	for name, tt := range tests {
+		got, err := OwnerFromToken(tt.token)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: owner = %q, want %q", name, got, tt.want)
+		}
+	}
+
+	for _, token := range []string{"opaque", testToken(`{"sub":"x"}`), "a.!!!.c"} {
+		if _, err := OwnerFromToken(token); err == nil {
+			t.Errorf("token %q: expected an error", token)
+		}
+	}
+}
+
+func TestOwnerFromEnvironment(t *testing.T) {
+
+	env := map[string]string{
+		"GITHUB_ACTOR":            "octocat",
+		"GITHUB_TRIGGERING_ACTOR": "hubot",
+	}
+	if got := OwnerFromEnvironment(func(name string) string { return env[name] }); got != "hubot" {
+		t.Errorf("owner = %q, want the triggering actor", got)
+	}
+
+	env["BUILD_REQUESTEDFOREMAIL"] = "jane.doe@contoso.com"
+	if got := OwnerFromEnvironment(func(name string) string { return env[name] }); got != "jane.doe@contoso.com" {
+		t.Errorf("owner = %q, want the Azure Pipelines requester", got)
+	}
+
+	if got := OwnerFromEnvironment(func(string) string { return "" }); got != "" {
+		t.Errorf("owner = %q outside of CI", got)
+	}
+}
+
+func TestBuildKeepsOriginalOwner(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "OWNER", "Jane.Doe@contoso.com")
+
+	if _, err := buildAndRun(t, c); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, _ := srv.Workspace(name)
+	if !slices.Contains(ws.Tags, "owner:jane-doe-contoso-com") {
+		t.Errorf("tags %v missing the owner", ws.Tags)
+	}
+	if got := variableValues(srv.Variables(name))["terraform/OWNER"].Value; got != "Jane.Doe@contoso.com" {
+		t.Errorf("terraform/OWNER = %q", got)
+	}
+
+	// Someone else starting the preview again does not take it over
+	set(c, "OWNER", "john@contoso.com")
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := variableValues(srv.Variables(name))["terraform/OWNER"].Value; got != "Jane.Doe@contoso.com" {
+		t.Errorf("terraform/OWNER = %q, want the original owner", got)
+	}
+
+	preview := Preview{Name: name, Tags: ws.Tags}
+	if !preview.OwnedBy("jane.doe@contoso.com") || preview.OwnedBy("john@contoso.com") {
+		t.Error("OwnedBy does not match the owner tag")
+	}
+
+}
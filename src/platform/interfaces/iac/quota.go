@@ -0,0 +1,165 @@
+package iac
+
+import (
+	"errors"
+	"fmt"
+	ci "main/interfaces/ci"
+	config "main/interfaces/configuration"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQuotaExceeded is returned when creating a workspace would exceed one of
+// the preview quotas.
+var ErrQuotaExceeded = errors.New("preview quota exceeded")
+
+// Quota is the maximum number of previews that may exist at once in the
+// preview project, per service, per owner and in total. Zero is unlimited.
+type Quota struct {
+	Service int
+	Owner   int
+	Total   int
+}
+
+// GetQuota returns the quotas set by MAX_PREVIEWS_PER_SERVICE,
+// MAX_PREVIEWS_PER_OWNER and MAX_PREVIEWS.
+func GetQuota(c *config.Configuration) (Quota, error) {
+
+	var quota Quota
+	limits := map[string]*int{
+		"MAX_PREVIEWS_PER_SERVICE": &quota.Service,
+		"MAX_PREVIEWS_PER_OWNER":   &quota.Owner,
+		"MAX_PREVIEWS":             &quota.Total,
+	}
+	for key, limit := range limits {
+		value := c.List[key].Value
+		if len(value) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return quota, fmt.Errorf("invalid %s '%s': must be a whole number greater than or equal to 0", key, value)
+		}
+		*limit = n
+	}
+	return quota, nil
+}
+
+// Reports whether QUOTA_OVERRIDE is set by someone allowed to. Only the
+// owners QUOTA_ADMINS lists may override the quotas, checked against
+// QUOTA_OVERRIDE_BY, the identity detected for the caller rather than OWNER.
+func overridesQuota(c *config.Configuration) (bool, error) {
+
+	enabled, _ := strconv.ParseBool(c.List["QUOTA_OVERRIDE"].Value)
+	if !enabled {
+		return false, nil
+	}
+
+	admins := c.List["QUOTA_ADMINS"].Value
+	if len(admins) == 0 {
+		return false, errors.New("preview quotas cannot be overridden as QUOTA_ADMINS is not set")
+	}
+	caller := c.List["QUOTA_OVERRIDE_BY"].Value
+	if len(caller) == 0 {
+		return false, errors.New("preview quotas cannot be overridden without knowing who is overriding them")
+	}
+	for _, admin := range strings.Split(admins, ",") {
+		if admin = strings.TrimSpace(admin); strings.EqualFold(admin, caller) {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("'%s' is not allowed to override preview quotas", caller)
+}
+
+// Checks that one more preview of the configured SERVICE and OWNER fits in
+// the quotas, given the previews that already exist.
+func checkQuota(c *config.Configuration, previews []Preview) error {
+
+	quota, err := GetQuota(c)
+	if err != nil {
+		return err
+	}
+	if quota == (Quota{}) {
+		return nil
+	}
+
+	override, err := overridesQuota(c)
+	if err != nil {
+		return err
+	}
+
+	service := c.List["SERVICE"].Value
+	owner := c.List["OWNER"].Value
+
+	checks := []struct {
+		limit    int
+		scope    string
+		previews []Preview
+	}{
+		{quota.Service, fmt.Sprintf("for service '%s'", service), filterPreviews(previews, func(p Preview) bool { return slices.Contains(p.Tags, service) })},
+		{quota.Owner, fmt.Sprintf("for owner '%s'", owner), filterPreviews(previews, func(p Preview) bool { return len(owner) != 0 && p.OwnedBy(owner) })},
+		{quota.Total, "in total", previews},
+	}
+
+	for _, check := range checks {
+		if check.limit == 0 || len(check.previews) < check.limit {
+			continue
+		}
+		if override {
+			ci.Warning("Overriding the quota of '%d' preview(s) %s", check.limit, check.scope)
+			continue
+		}
+		return quotaError(check.limit, check.scope, check.previews)
+	}
+	return nil
+}
+
+func filterPreviews(previews []Preview, keep func(Preview) bool) []Preview {
+	var filtered []Preview
+	for _, p := range previews {
+		if keep(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// Lists the previews counted against a quota, expired ones first and then
+// the oldest, and suggests stopping the first of them.
+func quotaError(limit int, scope string, previews []Preview) error {
+
+	sorted := slices.Clone(previews)
+	now := time.Now()
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		a_expired := !a.Expiration.IsZero() && a.Expiration.Before(now)
+		b_expired := !b.Expiration.IsZero() && b.Expiration.Before(now)
+		if a_expired != b_expired {
+			return a_expired
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "'%d' of '%d' preview(s) %s already exist:\n", len(previews), limit, scope)
+	for _, p := range sorted {
+		detail := "created " + p.CreatedAt.Format(time.RFC3339)
+		if owner := tagValue(p.Tags, OwnerTagPrefix); len(owner) != 0 {
+			detail += ", owner " + owner
+		}
+		if !p.Expiration.IsZero() {
+			if p.Expiration.Before(now) {
+				detail += ", expired"
+			} else {
+				detail += ", expires " + p.Expiration.Format(time.RFC3339)
+			}
+		}
+		fmt.Fprintf(&msg, "  %s (%s)\n", p.Name, detail)
+	}
+	fmt.Fprintf(&msg, "Stop one of them, e.g. 'platform preview stop --workspace %s', or ask an admin to start with --override-quota", sorted[0].Name)
+
+	return fmt.Errorf("%w: %s", ErrQuotaExceeded, msg.String())
+}
@@ -0,0 +1,105 @@
+package iac
+
+import (
+	"context"
+	"errors"
+	config "main/interfaces/configuration"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildWorkspace(t *testing.T, c *config.Configuration) error {
+	t.Helper()
+
+	var err error
+	captureStdout(t, func() {
+		_, err = NewDirector(newTestBuilder()).Build(context.Background(), c)
+	})
+	return err
+}
+
+func TestBuildEnforcesQuota(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "OWNER", "jane@contoso.com")
+	set(c, "MAX_PREVIEWS_PER_SERVICE", "2")
+
+	srv.AddWorkspace("api-one", PreviewProject, "api", OwnerTag("john@contoso.com"))
+	srv.AddWorkspace("api-two", PreviewProject, "api")
+	srv.AddWorkspace("web-one", PreviewProject, "web")
+
+	err := buildWorkspace(t, c)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want ErrQuotaExceeded", err)
+	}
+	if want := "preview quota exceeded: '2' of '2' preview(s) for service 'api' already exist:\n"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("error %q does not start with %q", err, want)
+	}
+	for _, want := range []string{"for service 'api'", "api-one", "api-two", "owner john-contoso-com", "preview stop --workspace"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "web-one") {
+		t.Errorf("error %q lists a preview of another service", err)
+	}
+	if _, ok := srv.Workspace(name); ok {
+		t.Error("workspace was created over the quota")
+	}
+
+	// Previews that already exist are not counted again
+	srv.AddWorkspace(name, PreviewProject, "api")
+	if err := buildWorkspace(t, c); err != nil {
+		t.Errorf("existing preview was refused: %v", err)
+	}
+}
+
+func TestBuildOverridesQuota(t *testing.T) {
+
+	srv, c := newTestServer(t)
+	name := setPreview(c, time.Now().Add(time.Hour))
+	set(c, "OWNER", "jane@contoso.com")
+	set(c, "MAX_PREVIEWS", "1")
+	set(c, "QUOTA_OVERRIDE", "true")
+
+	srv.AddWorkspace("api-one", PreviewProject, "api", OwnerTag("jane@contoso.com"))
+
+	// Nobody may override until admins are configured
+	set(c, "QUOTA_ADMINS", "")
+	if err := buildWorkspace(t, c); err == nil || !strings.Contains(err.Error(), "QUOTA_ADMINS is not set") {
+		t.Fatalf("err = %v, want the override refused", err)
+	}
+
+	set(c, "QUOTA_ADMINS", "admin@contoso.com")
+	if err := buildWorkspace(t, c); err == nil || !strings.Contains(err.Error(), "without knowing who") {
+		t.Fatalf("err = %v, want the override refused", err)
+	}
+
+	// Claiming an admin as the owner is not enough
+	set(c, "OWNER", "admin@contoso.com")
+	set(c, "QUOTA_OVERRIDE_BY", "jane@contoso.com")
+	if err := buildWorkspace(t, c); err == nil || !strings.Contains(err.Error(), "'jane@contoso.com' is not allowed to override") {
+		t.Fatalf("err = %v, want the override refused", err)
+	}
+
+	set(c, "QUOTA_ADMINS", "Jane@contoso.com, admin@contoso.com")
+	if err := buildWorkspace(t, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.Workspace(name); !ok {
+		t.Error("workspace was not created with the override")
+	}
+}
+
+func TestGetQuotaRejectsInvalidLimits(t *testing.T) {
+
+	for _, value := range []string{"-1", "two", "1.5"} {
+		c := &config.Configuration{List: map[string]config.KeyValue{}}
+		set(c, "MAX_PREVIEWS", value)
+		if _, err := GetQuota(c); err == nil {
+			t.Errorf("MAX_PREVIEWS '%s': expected an error", value)
+		}
+	}
+}
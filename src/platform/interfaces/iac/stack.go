@@ -0,0 +1,190 @@
+package iac
+
+import (
+	"errors"
+	"fmt"
+	config "main/interfaces/configuration"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Stack is a preview manifest listing several services, each built in its
+// own workspace, and how the outputs of one feed the variables of another.
+//
+//	services:
+//	  - name: networking
+//	  - name: database
+//	    depends_on: [networking]
+//	    inputs:
+//	      subnet_id: networking.subnet_id
+type Stack struct {
+	Services []StackService `yaml:"services"`
+}
+
+// StackService is a service of a stack. Inputs map Terraform variables of
+// the service to '<service>.<output>' of the services it depends on. Every
+// service referenced by an input is an implicit dependency.
+type StackService struct {
+	Name      string            `yaml:"name"`
+	DependsOn []string          `yaml:"depends_on"`
+	Inputs    map[string]string `yaml:"inputs"`
+}
+
+// LoadStack reads and validates a stack manifest.
+func LoadStack(path string) (*Stack, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack Stack
+	if err := yaml.Unmarshal(data, &stack); err != nil {
+		return nil, fmt.Errorf("invalid manifest '%s': %w", path, err)
+	}
+	if _, err := stack.Order(); err != nil {
+		return nil, fmt.Errorf("invalid manifest '%s': %w", path, err)
+	}
+	return &stack, nil
+}
+
+// Splits an input reference into its service and output.
+func parseInput(ref string) (string, string, error) {
+	service, output, ok := strings.Cut(ref, ".")
+	if !ok || len(service) == 0 || len(output) == 0 {
+		return "", "", fmt.Errorf("input '%s' must be '<service>.<output>'", ref)
+	}
+	return service, output, nil
+}
+
+// Returns the services s depends on, declared or through its inputs.
+func (s StackService) dependencies() ([]string, error) {
+
+	deps := slices.Clone(s.DependsOn)
+	for _, ref := range s.Inputs {
+		service, _, err := parseInput(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(deps, service) {
+			deps = append(deps, service)
+		}
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// Order returns the services so that every service comes after the services
+// it depends on. Services without dependencies between them keep the order
+// of the manifest.
+func (s Stack) Order() ([]StackService, error) {
+
+	if len(s.Services) == 0 {
+		return nil, errors.New("no services")
+	}
+
+	var (
+		index = make(map[string]int)
+		deps  = make([][]string, len(s.Services))
+	)
+	for i, service := range s.Services {
+		if len(service.Name) == 0 {
+			return nil, fmt.Errorf("service '%d' has no name", i+1)
+		}
+		if _, ok := index[service.Name]; ok {
+			return nil, fmt.Errorf("service '%s' is listed twice", service.Name)
+		}
+		index[service.Name] = i
+	}
+	for i, service := range s.Services {
+		d, err := service.dependencies()
+		if err != nil {
+			return nil, fmt.Errorf("service '%s': %w", service.Name, err)
+		}
+		for _, name := range d {
+			if _, ok := index[name]; !ok {
+				return nil, fmt.Errorf("service '%s' depends on unknown service '%s'", service.Name, name)
+			}
+			if name == service.Name {
+				return nil, fmt.Errorf("service '%s' depends on itself", service.Name)
+			}
+		}
+		deps[i] = d
+	}
+
+	// Depth-first, visiting services in manifest order
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		state = make([]int, len(s.Services))
+		order []StackService
+		visit func(i int, path []string) error
+	)
+	visit = func(i int, path []string) error {
+		path = append(path, s.Services[i].Name)
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, name := range deps[i] {
+			if err := visit(index[name], path); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		order = append(order, s.Services[i])
+		return nil
+	}
+	for i := range s.Services {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// StackInputs returns the configuration a service reads its inputs from,
+// given the outputs of the services already built. Strings are passed as
+// 'tfvar:' keys and every other type as HCL through 'tfvar-hcl:' keys.
+func StackInputs(service StackService, outputs map[string][]Output) (map[string]config.KeyValue, error) {
+
+	inputs := make(map[string]config.KeyValue)
+	for variable, ref := range service.Inputs {
+		name, output, err := parseInput(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		i := slices.IndexFunc(outputs[name], func(o Output) bool { return o.Name == output })
+		if i < 0 {
+			return nil, fmt.Errorf("service '%s' has no output '%s' for input '%s'", name, output, variable)
+		}
+		o := outputs[name][i]
+
+		key := "tfvar:" + variable
+		if _, ok := o.Value.(string); !ok {
+			key = "tfvar-hcl:" + variable
+		}
+		content_type := "text/plain"
+		if o.Sensitive {
+			content_type = sensitiveContentType
+		}
+		inputs[key] = config.KeyValue{
+			Name:        ref,
+			Value:       o.String(),
+			ContentType: content_type,
+		}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,172 @@
+package iac
+
+import (
+	config "main/interfaces/configuration"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, manifest string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "stack.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStackOrder(t *testing.T) {
+
+	path := writeManifest(t, `
+services:
+  - name: app
+    inputs:
+      connection_string: database.connection_string
+      subnet_id: networking.app_subnet_id
+  - name: database
+    depends_on: [networking]
+  - name: monitoring
+  - name: networking
+`)
+
+	stack, err := LoadStack(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := stack.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(order))
+	for i, service := range order {
+		names[i] = service.Name
+	}
+	want := []string{"networking", "database", "app", "monitoring"}
+	if !slices.Equal(names, want) {
+		t.Errorf("order = %v, want %v", names, want)
+	}
+}
+
+func TestStackRejectsInvalidManifests(t *testing.T) {
+
+	tests := map[string]string{
+		"cycle": `
+services:
+  - name: a
+    depends_on: [b]
+  - name: b
+    inputs:
+      x: a.x
+`,
+		"unknown service": `
+services:
+  - name: a
+    depends_on: [b]
+`,
+		"duplicate service": `
+services:
+  - name: a
+  - name: a
+`,
+		"malformed input": `
+services:
+  - name: a
+  - name: b
+    inputs:
+      x: a
+`,
+		"no services": `services: []`,
+	}
+
+	for name, manifest := range tests {
+		if _, err := LoadStack(writeManifest(t, manifest)); err == nil {
+			t.Errorf("%s: manifest was accepted", name)
+		}
+	}
+
+	_, err := LoadStack(writeManifest(t, tests["cycle"]))
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("err = %v, want the cycle", err)
+	}
+}
+
+func TestStackInputs(t *testing.T) {
+
+	service := StackService{
+		Name: "app",
+		Inputs: map[string]string{
+			"subnet_id":         "networking.subnet_id",
+			"address_space":     "networking.address_space",
+			"connection_string": "database.connection_string",
+		},
+	}
+	outputs := map[string][]Output{
+		"networking": {
+			{Name: "subnet_id", Type: "string", Value: "subnet-1"},
+			{Name: "address_space", Type: "list", Value: []interface{}{"10.0.0.0/16"}},
+		},
+		"database": {
+			{Name: "connection_string", Type: "string", Sensitive: true, Value: "Server=db"},
+		},
+	}
+
+	inputs, err := StackInputs(service, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &config.Configuration{List: inputs}
+	set(c, "tfvar:unrelated", "value")
+	vars, err := ResolveVariables(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Variable{
+		"terraform/subnet_id":         {Key: "subnet_id", Value: "subnet-1", Category: CategoryTerraform},
+		"terraform/address_space":     {Key: "address_space", Value: `["10.0.0.0/16"]`, Category: CategoryTerraform, HCL: true},
+		"terraform/connection_string": {Key: "connection_string", Value: "Server=db", Category: CategoryTerraform, Sensitive: true},
+		"terraform/unrelated":         {Key: "unrelated", Value: "value", Category: CategoryTerraform},
+	}
+	if len(vars) != len(want) {
+		t.Errorf("got %d variables, want %d: %v", len(vars), len(want), vars)
+	}
+	for id, v := range want {
+		if vars[id] != v {
+			t.Errorf("%s = %+v, want %+v", id, vars[id], v)
+		}
+	}
+
+	delete(outputs, "database")
+	if _, err := StackInputs(service, outputs); err == nil {
+		t.Error("inputs resolved without the output of a dependency")
+	}
+}
+
+func TestUnmappedKeys(t *testing.T) {
+
+	keys := []string{"tfvar:subnet_id", "tfvar-hcl:tags"}
+
+	c := &config.Configuration{List: map[string]config.KeyValue{}}
+	unmapped, err := UnmappedKeys(c, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unmapped) != 0 {
+		t.Errorf("default mappings: got %v unmapped, want none", unmapped)
+	}
+
+	set(c, "TFC_VARIABLES", `[{"key": "input:*", "category": "terraform"}, {"key": "tfvar:subnet_id", "category": "terraform"}]`)
+	unmapped, err = UnmappedKeys(c, append(keys, "input:sku"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(unmapped, []string{"tfvar-hcl:tags"}) {
+		t.Errorf("custom mappings: got %v unmapped, want [tfvar-hcl:tags]", unmapped)
+	}
+}
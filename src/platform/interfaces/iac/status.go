@@ -0,0 +1,50 @@
+package iac
+
+import (
+	"strings"
+	"time"
+)
+
+const OwnerTagPrefix = "owner:"
+
+// Status describes a single preview in detail.
+type Status struct {
+	Name          string      `json:"name"`
+	ID            string      `json:"id"`
+	URL           string      `json:"url"`
+	Branch        string      `json:"branch,omitempty"`
+	Commit        string      `json:"commit,omitempty"`
+	Run           *RunSummary `json:"run,omitempty"`
+	ResourceCount int         `json:"resource_count"`
+	Outputs       []Output    `json:"outputs"`
+	Expiration    *time.Time  `json:"expiration,omitempty"`
+	Owner         string      `json:"owner,omitempty"`
+	Locked        bool        `json:"locked"`
+}
+
+// RunSummary describes the latest run of a preview.
+type RunSummary struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	Duration  string    `json:"duration"`
+}
+
+// Returns the value of the first tag with the given prefix.
+func tagValue(tags []string, prefix string) string {
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, prefix); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// Returns the branch or pull request a preview was built from.
+func refFromTags(tags []string) string {
+	if pr := tagValue(tags, "pr:"); len(pr) != 0 {
+		return "pr-" + pr
+	}
+	return tagValue(tags, "branch:")
+}
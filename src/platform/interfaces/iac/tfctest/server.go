@@ -0,0 +1,1383 @@
+// Package tfctest provides an in-memory fake of the Terraform Cloud API
+// endpoints used by the TFC builder, so it can be exercised without a
+// real organization or network access.
+package tfctest
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-tfe"
+)
+
+// Server is a fake Terraform Cloud API served over TLS.
+type Server struct {
+	*httptest.Server
+	Organization string
+
+	mu         sync.Mutex
+	ids        int
+	projects   []*Project
+	workspaces []*Workspace
+	variables  map[string][]*Variable
+	varsets    []*VariableSet
+	notifiers  map[string][]*NotificationConfiguration
+	runs       []*Run
+	scripts    []RunScript
+}
+
+type Project struct {
+	ID   string
+	Name string
+}
+
+type Workspace struct {
+	ID               string
+	Name             string
+	ProjectID        string
+	WorkingDirectory string
+	Tags             []string
+	Locked           bool
+	CreatedAt        time.Time
+	ResourceCount    int
+	CurrentRunID     string
+	Outputs          []Output
+}
+
+type Variable struct {
+	ID          string
+	Key         string
+	Value       string
+	Description string
+	Category    string
+	HCL         bool
+	Sensitive   bool
+}
+
+type NotificationConfiguration struct {
+	ID              string
+	Name            string
+	DestinationType string
+	URL             string
+	Token           string
+	Enabled         bool
+	Triggers        []string
+}
+
+type VariableSet struct {
+	ID           string
+	Name         string
+	Global       bool
+	WorkspaceIDs []string
+}
+
+// Output is a state version output. IDs are assigned when a run applies.
+type Output struct {
+	ID        string
+	Name      string
+	Type      string
+	Sensitive bool
+	Value     interface{}
+}
+
+// Run is a run created through the API. Comments holds the comments sent
+// with apply, cancel and discard actions in the order they were received.
+type Run struct {
+	ID          string
+	WorkspaceID string
+	Message     string
+	IsDestroy   bool
+	AutoApply   bool
+	Status      tfe.RunStatus
+	Comments    []string
+	CreatedAt   time.Time
+
+	script    RunScript
+	step      int
+	confirmed bool
+	planned   bool
+	applying  bool
+	plan_id   string
+	apply_id  string
+}
+
+// RunScript scripts the statuses a run moves through. Every read of the run
+// advances it by one status. A run that does not auto-apply pauses on the
+// first confirmable status until it is applied or discarded.
+// ResourceCount is also applied when the run errors while applying.
+type RunScript struct {
+	Statuses      []tfe.RunStatus
+	PlanLog       string
+	ApplyLog      string
+	CostEstimate  *CostEstimate
+	ResourceCount int
+	Outputs       []Output
+}
+
+// CostEstimate holds the monthly costs reported once a run has planned.
+type CostEstimate struct {
+	Proposed string
+	Prior    string
+	Delta    string
+}
+
+// Used for runs created while no script is queued.
+var DefaultStatuses = []tfe.RunStatus{
+	tfe.RunPending,
+	tfe.RunPlanning,
+	tfe.RunPlanned,
+	tfe.RunApplying,
+	tfe.RunApplied,
+}
+
+// NewServer starts a fake for the given organization. Callers must Close it.
+func NewServer(organization string) *Server {
+	s := &Server{
+		Organization: organization,
+		variables:    make(map[string][]*Variable),
+		notifiers:    make(map[string][]*NotificationConfiguration),
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.route))
+	return s
+}
+
+// Hostname returns the host and port to use as TFC_HOSTNAME.
+func (s *Server) Hostname() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// WriteCABundle writes the server's certificate to path in PEM format, to be
+// used as TFC_CA_BUNDLE.
+func (s *Server) WriteCABundle(path string) error {
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+func (s *Server) newID(prefix string) string {
+	s.ids++
+	return fmt.Sprintf("%s-%08d", prefix, s.ids)
+}
+
+func (s *Server) AddProject(name string) Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &Project{ID: s.newID("prj"), Name: name}
+	s.projects = append(s.projects, p)
+	return *p
+}
+
+// AddWorkspace creates a workspace in the named project.
+func (s *Server) AddWorkspace(name string, project string, tags ...string) Workspace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws := &Workspace{
+		ID:        s.newID("ws"),
+		Name:      name,
+		Tags:      append([]string{}, tags...),
+		CreatedAt: time.Now().UTC(),
+	}
+	if p := s.findProject(project); p != nil {
+		ws.ProjectID = p.ID
+	}
+	s.workspaces = append(s.workspaces, ws)
+	return *ws
+}
+
+// AddVariable sets a variable on the named workspace.
+func (s *Server) AddVariable(workspace string, v Variable) Variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws := s.findWorkspace(workspace)
+	if ws == nil {
+		panic("tfctest: workspace '" + workspace + "' not found")
+	}
+	v.ID = s.newID("var")
+	s.variables[ws.ID] = append(s.variables[ws.ID], &v)
+	return v
+}
+
+func (s *Server) AddVariableSet(name string, global bool) VariableSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vs := &VariableSet{ID: s.newID("varset"), Name: name, Global: global}
+	s.varsets = append(s.varsets, vs)
+	return *vs
+}
+
+// QueueRun scripts the next run created. Scripts are used in the order they
+// were queued.
+func (s *Server) QueueRun(script RunScript) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts = append(s.scripts, script)
+}
+
+// Workspace returns a copy of the named workspace.
+func (s *Server) Workspace(name string) (Workspace, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ws := s.findWorkspace(name); ws != nil {
+		return *ws, true
+	}
+	return Workspace{}, false
+}
+
+// Workspaces returns the number of workspaces in the organization.
+func (s *Server) Workspaces() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.workspaces)
+}
+
+// Variables returns the variables of the named workspace sorted by key.
+func (s *Server) Variables(workspace string) []Variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Variable
+	if ws := s.findWorkspace(workspace); ws != nil {
+		for _, v := range s.variables[ws.ID] {
+			list = append(list, *v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+func (s *Server) VariableSet(name string) (VariableSet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, vs := range s.varsets {
+		if vs.Name == name {
+			return *vs, true
+		}
+	}
+	return VariableSet{}, false
+}
+
+// NotificationConfigurations returns the notification configurations of the
+// named workspace, in the order they were created.
+func (s *Server) NotificationConfigurations(workspace string) []NotificationConfiguration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []NotificationConfiguration
+	if ws := s.findWorkspace(workspace); ws != nil {
+		for _, nc := range s.notifiers[ws.ID] {
+			list = append(list, *nc)
+		}
+	}
+	return list
+}
+
+// Runs returns the runs created for a workspace ID, oldest first.
+func (s *Server) Runs(workspace_id string) []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Run
+	for _, r := range s.runs {
+		if r.WorkspaceID == workspace_id {
+			list = append(list, *r)
+		}
+	}
+	return list
+}
+
+func (s *Server) findProject(name string) *Project {
+	for _, p := range s.projects {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) findWorkspace(name string) *Workspace {
+	for _, ws := range s.workspaces {
+		if ws.Name == name {
+			return ws
+		}
+	}
+	return nil
+}
+
+func (s *Server) findWorkspaceByID(id string) *Workspace {
+	for _, ws := range s.workspaces {
+		if ws.ID == id {
+			return ws
+		}
+	}
+	return nil
+}
+
+func (s *Server) findRun(id string) *Run {
+	for _, r := range s.runs {
+		if r.ID == id || r.plan_id == id || r.apply_id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Server) findVariable(workspace_id string, id string) *Variable {
+	for _, v := range s.variables[workspace_id] {
+		if v.ID == id {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *Server) findOutput(id string) *Output {
+	for _, ws := range s.workspaces {
+		for i := range ws.Outputs {
+			if ws.Outputs[i].ID == id {
+				return &ws.Outputs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Routing
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path, ok := strings.CutPrefix(r.URL.Path, "/_logs/"); ok {
+		s.serveLog(w, r, strings.Split(path, "/"))
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/api/v2/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if path == "ping" {
+		w.Header().Set("TFP-API-Version", "2.6")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Authorization") == "Bearer " {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	seg := strings.Split(strings.Trim(path, "/"), "/")
+	match := func(method string, pattern ...string) bool {
+		if r.Method != method || len(seg) != len(pattern) {
+			return false
+		}
+		for i, p := range pattern {
+			if p != "*" && p != seg[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case match("GET", "organizations", "*", "projects"):
+		s.listProjects(w, r)
+	case match("GET", "organizations", "*", "workspaces"):
+		s.listWorkspaces(w, r)
+	case match("POST", "organizations", "*", "workspaces"):
+		s.createWorkspace(w, r)
+	case match("GET", "organizations", "*", "workspaces", "*"):
+		s.readWorkspace(w, s.findWorkspace(seg[3]))
+	case match("DELETE", "organizations", "*", "workspaces", "*"):
+		s.deleteWorkspace(w, s.findWorkspace(seg[3]))
+	case match("GET", "organizations", "*", "varsets"):
+		s.listVariableSets(w, r)
+	case match("GET", "workspaces", "*"):
+		s.readWorkspace(w, s.findWorkspaceByID(seg[1]))
+	case match("POST", "workspaces", "*", "relationships", "tags"):
+		s.updateTags(w, r, seg[1], true)
+	case match("DELETE", "workspaces", "*", "relationships", "tags"):
+		s.updateTags(w, r, seg[1], false)
+	case match("POST", "workspaces", "*", "actions", "*"):
+		s.lockWorkspace(w, seg[1], seg[3])
+	case match("GET", "workspaces", "*", "vars"):
+		s.listVariables(w, r, seg[1])
+	case match("POST", "workspaces", "*", "vars"):
+		s.createVariable(w, r, seg[1])
+	case match("PATCH", "workspaces", "*", "vars", "*"):
+		s.updateVariable(w, r, seg[1], seg[3])
+	case match("DELETE", "workspaces", "*", "vars", "*"):
+		s.deleteVariable(w, seg[1], seg[3])
+	case match("POST", "workspaces", "*", "notification-configurations"):
+		s.createNotificationConfiguration(w, r, seg[1])
+	case match("GET", "workspaces", "*", "current-state-version-outputs"):
+		s.listOutputs(w, seg[1])
+	case match("GET", "state-version-outputs", "*"):
+		s.readOutput(w, seg[1])
+	case match("POST", "varsets", "*", "relationships", "workspaces"):
+		s.applyVariableSet(w, r, seg[1])
+	case match("POST", "runs"):
+		s.createRun(w, r)
+	case match("GET", "runs", "*"):
+		s.readRun(w, seg[1])
+	case match("POST", "runs", "*", "actions", "*"):
+		s.runAction(w, r, seg[1], seg[3])
+	case match("GET", "plans", "*"):
+		s.readPhase(w, seg[1], "plans")
+	case match("GET", "applies", "*"):
+		s.readPhase(w, seg[1], "applies")
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no fake for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// Projects
+func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
+
+	names := r.URL.Query().Get("filter[names]")
+
+	var list []resource
+	for _, p := range s.projects {
+		if len(names) != 0 && !slices.ContainsFunc(strings.Split(names, ","), func(n string) bool {
+			return strings.Contains(p.Name, n)
+		}) {
+			continue
+		}
+		list = append(list, resource{Type: "projects", ID: p.ID, Attributes: attributes{"name": p.Name}})
+	}
+
+	writeList(w, r, list)
+}
+
+// Workspaces
+func (s *Server) workspaceResource(ws *Workspace) resource {
+	return resource{
+		Type: "workspaces",
+		ID:   ws.ID,
+		Attributes: attributes{
+			"name":              ws.Name,
+			"created-at":        ws.CreatedAt.Format(time.RFC3339),
+			"locked":            ws.Locked,
+			"resource-count":    ws.ResourceCount,
+			"tag-names":         append([]string{}, ws.Tags...),
+			"working-directory": ws.WorkingDirectory,
+			"execution-mode":    "remote",
+		},
+		Relationships: map[string]relationship{
+			"organization": toOne("organizations", s.Organization),
+			"project":      toOne("projects", ws.ProjectID),
+			"current-run":  toOne("runs", ws.CurrentRunID),
+		},
+	}
+}
+
+func (s *Server) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		query   = r.URL.Query()
+		search  = query.Get("search[name]")
+		project = query.Get("filter[project][id]")
+		tags    = query.Get("search[tags]")
+	)
+
+	var list []resource
+	for _, ws := range s.workspaces {
+		if !strings.Contains(ws.Name, search) {
+			continue
+		}
+		if len(project) != 0 && ws.ProjectID != project {
+			continue
+		}
+		if len(tags) != 0 && !containsAll(ws.Tags, strings.Split(tags, ",")) {
+			continue
+		}
+		list = append(list, s.workspaceResource(ws))
+	}
+
+	// Only the current run can be included
+	var include func(items []resource) []resource
+	if slices.Contains(strings.Split(query.Get("include"), ","), "current_run") {
+		include = func(items []resource) []resource {
+			var included []resource
+			for _, item := range items {
+				if r := s.findRun(s.findWorkspaceByID(item.ID).CurrentRunID); r != nil {
+					run, _ := s.runResource(r)
+					included = append(included, run)
+				}
+			}
+			return included
+		}
+	}
+
+	writeListIncluded(w, r, list, include)
+}
+
+func (s *Server) readWorkspace(w http.ResponseWriter, ws *Workspace) {
+	if ws == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+	writeResource(w, http.StatusOK, s.workspaceResource(ws))
+}
+
+func (s *Server) createWorkspace(w http.ResponseWriter, r *http.Request) {
+
+	var body struct {
+		Data struct {
+			Attributes struct {
+				Name             string `json:"name"`
+				WorkingDirectory string `json:"working-directory"`
+			} `json:"attributes"`
+			Relationships struct {
+				Project struct {
+					Data *resource `json:"data"`
+				} `json:"project"`
+				Tags struct {
+					Data []resource `json:"data"`
+				} `json:"tags"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	attr := body.Data.Attributes
+	if len(attr.Name) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "name is required")
+		return
+	}
+	if s.findWorkspace(attr.Name) != nil {
+		writeError(w, http.StatusUnprocessableEntity, "name has already been taken")
+		return
+	}
+
+	ws := &Workspace{
+		ID:               s.newID("ws"),
+		Name:             attr.Name,
+		WorkingDirectory: attr.WorkingDirectory,
+		Tags:             []string{},
+		CreatedAt:        time.Now().UTC(),
+	}
+	if p := body.Data.Relationships.Project.Data; p != nil {
+		ws.ProjectID = p.ID
+	}
+	for _, tag := range body.Data.Relationships.Tags.Data {
+		if name, ok := tag.Attributes["name"].(string); ok {
+			ws.Tags = append(ws.Tags, name)
+		}
+	}
+	s.workspaces = append(s.workspaces, ws)
+
+	writeResource(w, http.StatusCreated, s.workspaceResource(ws))
+}
+
+func (s *Server) deleteWorkspace(w http.ResponseWriter, ws *Workspace) {
+	if ws == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+	s.workspaces = slices.DeleteFunc(s.workspaces, func(other *Workspace) bool { return other == ws })
+	delete(s.variables, ws.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) updateTags(w http.ResponseWriter, r *http.Request, id string, add bool) {
+
+	ws := s.findWorkspaceByID(id)
+	if ws == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+
+	var body struct {
+		Data []resource `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, tag := range body.Data {
+		name, _ := tag.Attributes["name"].(string)
+		if add && !slices.Contains(ws.Tags, name) {
+			ws.Tags = append(ws.Tags, name)
+		} else if !add {
+			ws.Tags = slices.DeleteFunc(ws.Tags, func(t string) bool { return t == name })
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) lockWorkspace(w http.ResponseWriter, id string, action string) {
+
+	ws := s.findWorkspaceByID(id)
+	if ws == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+
+	switch action {
+	case "lock":
+		if ws.Locked {
+			writeError(w, http.StatusConflict, "workspace already locked")
+			return
+		}
+		ws.Locked = true
+	case "unlock", "force-unlock":
+		if !ws.Locked {
+			writeError(w, http.StatusConflict, "workspace already unlocked")
+			return
+		}
+		ws.Locked = false
+	default:
+		writeError(w, http.StatusNotFound, "unknown action")
+		return
+	}
+
+	writeResource(w, http.StatusOK, s.workspaceResource(ws))
+}
+
+// Variables
+func variableResource(v *Variable) resource {
+	value := v.Value
+	if v.Sensitive {
+		value = ""
+	}
+	return resource{
+		Type: "vars",
+		ID:   v.ID,
+		Attributes: attributes{
+			"key":         v.Key,
+			"value":       value,
+			"description": v.Description,
+			"category":    v.Category,
+			"hcl":         v.HCL,
+			"sensitive":   v.Sensitive,
+		},
+	}
+}
+
+type variableAttributes struct {
+	Key         *string `json:"key"`
+	Value       *string `json:"value"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+	HCL         *bool   `json:"hcl"`
+	Sensitive   *bool   `json:"sensitive"`
+}
+
+func decodeVariable(r *http.Request) (variableAttributes, error) {
+	var body struct {
+		Data struct {
+			Attributes variableAttributes `json:"attributes"`
+		} `json:"data"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	return body.Data.Attributes, err
+}
+
+func (s *Server) listVariables(w http.ResponseWriter, r *http.Request, id string) {
+
+	if s.findWorkspaceByID(id) == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+
+	var list []resource
+	for _, v := range s.variables[id] {
+		list = append(list, variableResource(v))
+	}
+
+	writeList(w, r, list)
+}
+
+func (s *Server) createVariable(w http.ResponseWriter, r *http.Request, id string) {
+
+	if s.findWorkspaceByID(id) == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+
+	attr, err := decodeVariable(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if attr.Key == nil || attr.Category == nil {
+		writeError(w, http.StatusUnprocessableEntity, "key and category are required")
+		return
+	}
+	for _, v := range s.variables[id] {
+		if v.Key == *attr.Key && v.Category == *attr.Category {
+			writeError(w, http.StatusUnprocessableEntity, "key has already been taken")
+			return
+		}
+	}
+
+	v := &Variable{ID: s.newID("var"), Key: *attr.Key, Category: *attr.Category}
+	applyVariable(v, attr)
+	s.variables[id] = append(s.variables[id], v)
+
+	writeResource(w, http.StatusCreated, variableResource(v))
+}
+
+func (s *Server) updateVariable(w http.ResponseWriter, r *http.Request, id string, variable_id string) {
+
+	v := s.findVariable(id, variable_id)
+	if v == nil {
+		writeError(w, http.StatusNotFound, "variable not found")
+		return
+	}
+
+	attr, err := decodeVariable(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if attr.Key != nil {
+		v.Key = *attr.Key
+	}
+	applyVariable(v, attr)
+
+	writeResource(w, http.StatusOK, variableResource(v))
+}
+
+func applyVariable(v *Variable, attr variableAttributes) {
+	if attr.Value != nil {
+		v.Value = *attr.Value
+	}
+	if attr.Description != nil {
+		v.Description = *attr.Description
+	}
+	if attr.HCL != nil {
+		v.HCL = *attr.HCL
+	}
+	if attr.Sensitive != nil {
+		v.Sensitive = *attr.Sensitive
+	}
+}
+
+func (s *Server) deleteVariable(w http.ResponseWriter, id string, variable_id string) {
+
+	v := s.findVariable(id, variable_id)
+	if v == nil {
+		writeError(w, http.StatusNotFound, "variable not found")
+		return
+	}
+	s.variables[id] = slices.DeleteFunc(s.variables[id], func(other *Variable) bool { return other == v })
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Notification Configurations
+func (s *Server) createNotificationConfiguration(w http.ResponseWriter, r *http.Request, id string) {
+
+	if s.findWorkspaceByID(id) == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+
+	var body struct {
+		Data struct {
+			Attributes struct {
+				Name            string   `json:"name"`
+				DestinationType string   `json:"destination-type"`
+				URL             string   `json:"url"`
+				Token           string   `json:"token"`
+				Enabled         bool     `json:"enabled"`
+				Triggers        []string `json:"triggers"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	attr := body.Data.Attributes
+	nc := &NotificationConfiguration{
+		ID:              s.newID("nc"),
+		Name:            attr.Name,
+		DestinationType: attr.DestinationType,
+		URL:             attr.URL,
+		Token:           attr.Token,
+		Enabled:         attr.Enabled,
+		Triggers:        attr.Triggers,
+	}
+	s.notifiers[id] = append(s.notifiers[id], nc)
+
+	writeResource(w, http.StatusCreated, resource{
+		Type: "notification-configurations",
+		ID:   nc.ID,
+		Attributes: attributes{
+			"name":             nc.Name,
+			"destination-type": nc.DestinationType,
+			"url":              nc.URL,
+			"enabled":          nc.Enabled,
+			"triggers":         nc.Triggers,
+		},
+	})
+}
+
+// Variable Sets
+func (s *Server) listVariableSets(w http.ResponseWriter, r *http.Request) {
+
+	var list []resource
+	for _, vs := range s.varsets {
+		list = append(list, resource{
+			Type:       "varsets",
+			ID:         vs.ID,
+			Attributes: attributes{"name": vs.Name, "global": vs.Global},
+		})
+	}
+
+	writeList(w, r, list)
+}
+
+func (s *Server) applyVariableSet(w http.ResponseWriter, r *http.Request, id string) {
+
+	var vs *VariableSet
+	for _, candidate := range s.varsets {
+		if candidate.ID == id {
+			vs = candidate
+		}
+	}
+	if vs == nil {
+		writeError(w, http.StatusNotFound, "variable set not found")
+		return
+	}
+
+	var body struct {
+		Data []resource `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, ws := range body.Data {
+		if !slices.Contains(vs.WorkspaceIDs, ws.ID) {
+			vs.WorkspaceIDs = append(vs.WorkspaceIDs, ws.ID)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// State Version Outputs
+func outputResource(o *Output, with_value bool) resource {
+	var value interface{}
+	if with_value || !o.Sensitive {
+		value = o.Value
+	}
+	return resource{
+		Type: "state-version-outputs",
+		ID:   o.ID,
+		Attributes: attributes{
+			"name":      o.Name,
+			"type":      o.Type,
+			"sensitive": o.Sensitive,
+			"value":     value,
+		},
+	}
+}
+
+func (s *Server) listOutputs(w http.ResponseWriter, id string) {
+
+	ws := s.findWorkspaceByID(id)
+	if ws == nil || ws.Outputs == nil {
+		writeError(w, http.StatusNotFound, "state version not found")
+		return
+	}
+
+	list := []resource{}
+	for i := range ws.Outputs {
+		list = append(list, outputResource(&ws.Outputs[i], false))
+	}
+
+	writeDocument(w, http.StatusOK, document{Data: list, Meta: paginationMeta(1, 0, len(list))})
+}
+
+func (s *Server) readOutput(w http.ResponseWriter, id string) {
+
+	o := s.findOutput(id)
+	if o == nil {
+		writeError(w, http.StatusNotFound, "output not found")
+		return
+	}
+
+	writeResource(w, http.StatusOK, outputResource(o, true))
+}
+
+// Runs
+func isFinal(status tfe.RunStatus) bool {
+	switch status {
+	case tfe.RunApplied, tfe.RunPlannedAndFinished, tfe.RunErrored, tfe.RunCanceled, tfe.RunDiscarded:
+		return true
+	}
+	return false
+}
+
+func isConfirmable(status tfe.RunStatus) bool {
+	switch status {
+	case tfe.RunPlanned, tfe.RunCostEstimated, tfe.RunPolicyChecked:
+		return true
+	}
+	return false
+}
+
+func isPlanning(status tfe.RunStatus) bool {
+	switch status {
+	case tfe.RunPending, tfe.RunPlanQueued, tfe.RunPlanning:
+		return true
+	}
+	return false
+}
+
+func isApplying(status tfe.RunStatus) bool {
+	switch status {
+	case tfe.RunConfirmed, tfe.RunApplyQueued, tfe.RunApplying, tfe.RunApplied:
+		return true
+	}
+	return false
+}
+
+func (r *Run) paused() bool {
+	return !r.AutoApply && !r.confirmed && isConfirmable(r.Status)
+}
+
+// Moves the run to its next scripted status.
+func (s *Server) advance(r *Run) {
+
+	if isFinal(r.Status) || r.paused() || r.step >= len(r.script.Statuses)-1 {
+		return
+	}
+
+	r.step++
+	s.setStatus(r, r.script.Statuses[r.step])
+}
+
+func (s *Server) setStatus(r *Run, status tfe.RunStatus) {
+
+	r.Status = status
+	if !isPlanning(status) && status != tfe.RunErrored && status != tfe.RunCanceled {
+		r.planned = true
+	}
+	if isApplying(status) {
+		r.applying = true
+	}
+
+	ws := s.findWorkspaceByID(r.WorkspaceID)
+	if ws == nil {
+		return
+	}
+
+	// An apply that errors part way still leaves resources behind
+	if status == tfe.RunErrored && r.applying && !r.IsDestroy {
+		ws.ResourceCount = r.script.ResourceCount
+		return
+	}
+	if status != tfe.RunApplied {
+		return
+	}
+
+	if r.IsDestroy {
+		ws.ResourceCount = 0
+		ws.Outputs = []Output{}
+		return
+	}
+	ws.ResourceCount = r.script.ResourceCount
+	ws.Outputs = []Output{}
+	for _, o := range r.script.Outputs {
+		o.ID = s.newID("wsout")
+		ws.Outputs = append(ws.Outputs, o)
+	}
+}
+
+func (r *Run) planStatus() tfe.PlanStatus {
+	switch {
+	case r.planned:
+		return tfe.PlanFinished
+	case r.Status == tfe.RunErrored:
+		return tfe.PlanErrored
+	case r.Status == tfe.RunCanceled:
+		return tfe.PlanCanceled
+	case r.Status == tfe.RunPlanning:
+		return tfe.PlanRunning
+	}
+	return tfe.PlanPending
+}
+
+func (r *Run) applyStatus() tfe.ApplyStatus {
+	switch {
+	case r.Status == tfe.RunApplied:
+		return tfe.ApplyFinished
+	case r.applying && r.Status == tfe.RunErrored:
+		return tfe.ApplyErrored
+	case r.applying && r.Status == tfe.RunCanceled:
+		return tfe.ApplyCanceled
+	case r.applying:
+		return tfe.ApplyRunning
+	case isFinal(r.Status):
+		return tfe.ApplyUnreachable
+	}
+	return tfe.ApplyPending
+}
+
+func (s *Server) runResource(r *Run) (resource, []resource) {
+
+	paused := r.paused()
+
+	run := resource{
+		Type: "runs",
+		ID:   r.ID,
+		Attributes: attributes{
+			"status":     r.Status,
+			"message":    r.Message,
+			"is-destroy": r.IsDestroy,
+			"auto-apply": r.AutoApply,
+			"created-at": r.CreatedAt.Format(time.RFC3339),
+			"actions": attributes{
+				"is-cancelable":       !paused && !isFinal(r.Status),
+				"is-confirmable":      paused,
+				"is-discardable":      paused,
+				"is-force-cancelable": false,
+			},
+		},
+		Relationships: map[string]relationship{
+			"workspace":     toOne("workspaces", r.WorkspaceID),
+			"plan":          toOne("plans", r.plan_id),
+			"apply":         toOne("applies", r.apply_id),
+			"cost-estimate": toOne("cost-estimates", ""),
+		},
+	}
+
+	included := []resource{
+		s.phaseResource(r, "plans"),
+		s.phaseResource(r, "applies"),
+	}
+
+	if ce := r.script.CostEstimate; ce != nil {
+		status := tfe.CostEstimatePending
+		if r.planned {
+			status = tfe.CostEstimateFinished
+		}
+		run.Relationships["cost-estimate"] = toOne("cost-estimates", "ce-"+r.ID)
+		included = append(included, resource{
+			Type: "cost-estimates",
+			ID:   "ce-" + r.ID,
+			Attributes: attributes{
+				"status":                status,
+				"proposed-monthly-cost": ce.Proposed,
+				"prior-monthly-cost":    ce.Prior,
+				"delta-monthly-cost":    ce.Delta,
+			},
+		})
+	}
+
+	return run, included
+}
+
+func (s *Server) phaseResource(r *Run, kind string) resource {
+	if kind == "plans" {
+		return resource{
+			Type: kind,
+			ID:   r.plan_id,
+			Attributes: attributes{
+				"status":       r.planStatus(),
+				"log-read-url": s.URL + "/_logs/plans/" + r.plan_id,
+			},
+		}
+	}
+	return resource{
+		Type: kind,
+		ID:   r.apply_id,
+		Attributes: attributes{
+			"status":       r.applyStatus(),
+			"log-read-url": s.URL + "/_logs/applies/" + r.apply_id,
+		},
+	}
+}
+
+func (s *Server) createRun(w http.ResponseWriter, r *http.Request) {
+
+	var body struct {
+		Data struct {
+			Attributes struct {
+				Message   string `json:"message"`
+				IsDestroy bool   `json:"is-destroy"`
+				AutoApply bool   `json:"auto-apply"`
+			} `json:"attributes"`
+			Relationships struct {
+				Workspace struct {
+					Data *resource `json:"data"`
+				} `json:"workspace"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rel := body.Data.Relationships.Workspace.Data
+	if rel == nil || s.findWorkspaceByID(rel.ID) == nil {
+		writeError(w, http.StatusNotFound, "workspace not found")
+		return
+	}
+	ws := s.findWorkspaceByID(rel.ID)
+
+	script := RunScript{Statuses: DefaultStatuses}
+	if len(s.scripts) != 0 {
+		script, s.scripts = s.scripts[0], s.scripts[1:]
+	}
+	if len(script.Statuses) == 0 {
+		script.Statuses = DefaultStatuses
+	}
+
+	attr := body.Data.Attributes
+	run := &Run{
+		ID:          s.newID("run"),
+		WorkspaceID: ws.ID,
+		Message:     attr.Message,
+		IsDestroy:   attr.IsDestroy,
+		AutoApply:   attr.AutoApply,
+		CreatedAt:   time.Now().UTC(),
+		script:      script,
+	}
+	run.plan_id = "plan-" + run.ID
+	run.apply_id = "apply-" + run.ID
+	s.setStatus(run, script.Statuses[0])
+	s.runs = append(s.runs, run)
+	ws.CurrentRunID = run.ID
+
+	data, included := s.runResource(run)
+	writeDocument(w, http.StatusCreated, document{Data: data, Included: included})
+}
+
+func (s *Server) readRun(w http.ResponseWriter, id string) {
+
+	run := s.findRun(id)
+	if run == nil || run.ID != id {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	s.advance(run)
+
+	data, included := s.runResource(run)
+	writeDocument(w, http.StatusOK, document{Data: data, Included: included})
+}
+
+func (s *Server) runAction(w http.ResponseWriter, r *http.Request, id string, action string) {
+
+	run := s.findRun(id)
+	if run == nil || run.ID != id {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch action {
+	case "apply":
+		if !run.paused() {
+			writeError(w, http.StatusConflict, "transition not allowed")
+			return
+		}
+		run.confirmed = true
+	case "discard":
+		if !run.paused() {
+			writeError(w, http.StatusConflict, "transition not allowed")
+			return
+		}
+		s.setStatus(run, tfe.RunDiscarded)
+	case "cancel", "force-cancel":
+		if isFinal(run.Status) {
+			writeError(w, http.StatusConflict, "transition not allowed")
+			return
+		}
+		s.setStatus(run, tfe.RunCanceled)
+	default:
+		writeError(w, http.StatusNotFound, "unknown action")
+		return
+	}
+
+	run.Comments = append(run.Comments, body.Comment)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) readPhase(w http.ResponseWriter, id string, kind string) {
+
+	run := s.findRun(id)
+	if run == nil || run.ID == id {
+		writeError(w, http.StatusNotFound, kind+" not found")
+		return
+	}
+
+	writeResource(w, http.StatusOK, s.phaseResource(run, kind))
+}
+
+// Logs are wrapped in STX and ETX like the real log archive, and served in
+// chunks using the limit and offset query parameters.
+func (s *Server) serveLog(w http.ResponseWriter, r *http.Request, seg []string) {
+
+	if len(seg) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	run := s.findRun(seg[1])
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	text := run.script.PlanLog
+	if seg[0] == "applies" {
+		text = run.script.ApplyLog
+	}
+	text = "\x02" + text + "\x03"
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(text)
+	}
+	offset = min(offset, len(text))
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(text[offset:min(offset+limit, len(text))]))
+}
+
+// JSON:API Documents
+type attributes map[string]interface{}
+
+type resource struct {
+	Type          string                  `json:"type"`
+	ID            string                  `json:"id,omitempty"`
+	Attributes    attributes              `json:"attributes,omitempty"`
+	Relationships map[string]relationship `json:"relationships,omitempty"`
+}
+
+type relationship struct {
+	Data interface{} `json:"data"`
+}
+
+type document struct {
+	Data     interface{}            `json:"data"`
+	Included []resource             `json:"included,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+func toOne(kind string, id string) relationship {
+	if len(id) == 0 {
+		return relationship{}
+	}
+	return relationship{Data: resource{Type: kind, ID: id}}
+}
+
+func containsAll(values []string, wanted []string) bool {
+	for _, v := range wanted {
+		if !slices.Contains(values, strings.TrimSpace(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func paginationMeta(page int, size int, total int) map[string]interface{} {
+	pages := 1
+	if size > 0 && total > 0 {
+		pages = (total + size - 1) / size
+	}
+	next := 0
+	if page < pages {
+		next = page + 1
+	}
+	return map[string]interface{}{
+		"pagination": map[string]int{
+			"current-page": page,
+			"next-page":    next,
+			"prev-page":    page - 1,
+			"total-pages":  pages,
+			"total-count":  total,
+		},
+	}
+}
+
+// Writes one page of list, honouring page[number] and page[size].
+func writeList(w http.ResponseWriter, r *http.Request, list []resource) {
+	writeListIncluded(w, r, list, nil)
+}
+
+// Like writeList, including the resources include returns for the page.
+func writeListIncluded(w http.ResponseWriter, r *http.Request, list []resource, include func(items []resource) []resource) {
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page[number]"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(r.URL.Query().Get("page[size]"))
+	if err != nil || size < 1 {
+		size = 20
+	}
+
+	start := min((page-1)*size, len(list))
+	end := min(start+size, len(list))
+
+	items := append([]resource{}, list[start:end]...)
+	doc := document{Data: items, Meta: paginationMeta(page, size, len(list))}
+	if include != nil {
+		doc.Included = include(items)
+	}
+	writeDocument(w, http.StatusOK, doc)
+}
+
+func writeResource(w http.ResponseWriter, status int, res resource) {
+	writeDocument(w, status, document{Data: res})
+}
+
+func writeDocument(w http.ResponseWriter, status int, doc document) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(doc)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{
+			"status": strconv.Itoa(status),
+			"title":  http.StatusText(status),
+			"detail": detail,
+		}},
+	})
+}
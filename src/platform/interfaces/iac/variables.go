@@ -0,0 +1,185 @@
+package iac
+
+import (
+	"encoding/json"
+	"fmt"
+	config "main/interfaces/configuration"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	CategoryTerraform = "terraform"
+	CategoryEnv       = "env"
+
+	keyVaultContentType = "application/vnd.microsoft.appconfig.keyvaultref+json"
+
+	// Marks values wired from sensitive outputs of another workspace
+	sensitiveContentType = "text/plain; sensitive"
+
+	// Marks workspace variables set by the CLI. Only these are removed when
+	// they are no longer declared, so variables set by hand are kept.
+	ManagedVariableDescription = "Managed by platform"
+)
+
+// Variable is a Terraform or environment variable to be set on a workspace.
+type Variable struct {
+	Key       string
+	Value     string
+	Category  string
+	HCL       bool
+	Sensitive bool
+}
+
+// VariableMapping declares how configuration keys become workspace variables.
+// A Key ending in '*' matches every configuration key with that prefix, and
+// the matched suffix replaces the '*' in Name (default: the suffix itself).
+type VariableMapping struct {
+	Key       string `json:"key"`
+	Name      string `json:"name,omitempty"`
+	Category  string `json:"category"`
+	HCL       bool   `json:"hcl,omitempty"`
+	Sensitive *bool  `json:"sensitive,omitempty"`
+}
+
+// Used when TFC_VARIABLES is not present in configuration.
+var defaultVariableMappings = []VariableMapping{
+	{Key: "ARM_TENANT_ID", Category: CategoryEnv},
+	{Key: "ARM_CLIENT_ID", Category: CategoryEnv},
+	{Key: "ARM_CLIENT_SECRET", Category: CategoryEnv, Sensitive: BoolPointer(true)},
+	{Key: "tfvar:*", Category: CategoryTerraform},
+	{Key: "tfvar-hcl:*", Category: CategoryTerraform, HCL: true},
+	{Key: "envvar:*", Category: CategoryEnv},
+}
+
+// Returns a unique identifier for a variable within a workspace.
+func (v Variable) id() string {
+	return v.Category + "/" + v.Key
+}
+
+func getVariableMappings(c *config.Configuration) ([]VariableMapping, error) {
+
+	value, ok := c.List["TFC_VARIABLES"]
+	if !ok || len(value.Value) == 0 {
+		return defaultVariableMappings, nil
+	}
+
+	var mappings []VariableMapping
+	if err := json.Unmarshal([]byte(value.Value), &mappings); err != nil {
+		return nil, fmt.Errorf("invalid TFC_VARIABLES: %w", err)
+	}
+
+	for _, m := range mappings {
+		if m.Category != CategoryTerraform && m.Category != CategoryEnv {
+			return nil, fmt.Errorf("invalid TFC_VARIABLES: key '%s' has unsupported category '%s'", m.Key, m.Category)
+		}
+	}
+
+	return mappings, nil
+}
+
+// Reports whether the mapping turns the configuration key into a variable.
+func (m VariableMapping) matches(key string) bool {
+	if prefix, ok := strings.CutSuffix(m.Key, "*"); ok {
+		suffix, ok := strings.CutPrefix(key, prefix)
+		return ok && len(suffix) != 0
+	}
+	return m.Key == key
+}
+
+// UnmappedKeys returns the configuration keys that no variable mapping
+// turns into a workspace variable, so their values would never reach it.
+func UnmappedKeys(c *config.Configuration, keys []string) ([]string, error) {
+
+	mappings, err := getVariableMappings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var unmapped []string
+	for _, key := range keys {
+		if !slices.ContainsFunc(mappings, func(m VariableMapping) bool { return m.matches(key) }) {
+			unmapped = append(unmapped, key)
+		}
+	}
+	sort.Strings(unmapped)
+	return unmapped, nil
+}
+
+func (m VariableMapping) variable(name string, kv config.KeyValue) Variable {
+
+	// Secrets resolved from Key Vault are sensitive unless stated otherwise
+	sensitive := strings.HasPrefix(kv.ContentType, keyVaultContentType) || kv.ContentType == sensitiveContentType
+	if m.Sensitive != nil {
+		sensitive = *m.Sensitive
+	}
+
+	return Variable{
+		Key:       name,
+		Value:     kv.Value,
+		Category:  m.Category,
+		HCL:       m.HCL,
+		Sensitive: sensitive,
+	}
+}
+
+// ResolveVariables applies the configured variable mappings to the
+// configuration. Mapped keys missing from the configuration are skipped.
+func ResolveVariables(c *config.Configuration) (map[string]Variable, error) {
+
+	mappings, err := getVariableMappings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Iterate in a stable order so later mappings consistently win
+	keys := make([]string, 0, len(c.List))
+	for k := range c.List {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	variables := make(map[string]Variable)
+	for _, m := range mappings {
+		if prefix, ok := strings.CutSuffix(m.Key, "*"); ok {
+			for _, k := range keys {
+				suffix, ok := strings.CutPrefix(k, prefix)
+				if !ok || len(suffix) == 0 {
+					continue
+				}
+				name := suffix
+				if len(m.Name) != 0 {
+					name = strings.Replace(m.Name, "*", suffix, 1)
+				}
+				v := m.variable(name, c.List[k])
+				variables[v.id()] = v
+			}
+			continue
+		}
+
+		kv, ok := c.List[m.Key]
+		if !ok {
+			continue
+		}
+		name := m.Key
+		if len(m.Name) != 0 {
+			name = m.Name
+		}
+		v := m.variable(name, kv)
+		variables[v.id()] = v
+	}
+
+	return variables, nil
+}
+
+// Returns the names of the existing variable sets to attach to a workspace.
+func getVariableSets(c *config.Configuration) []string {
+	var sets []string
+	for _, name := range strings.Split(c.List["TFC_VARIABLE_SETS"].Value, ",") {
+		if name = strings.TrimSpace(name); len(name) != 0 {
+			sets = append(sets, name)
+		}
+	}
+	return sets
+}
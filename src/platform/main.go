@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	ci "main/interfaces/ci"
 	"os"
 )
 
@@ -15,6 +15,7 @@ func main() {
 	app := get_default_cli(Version, Revision)
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		ci.Error("%v", err)
+		os.Exit(1)
 	}
 }